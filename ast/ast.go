@@ -0,0 +1,179 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/contactkeval/expressioneval/datatype"
+	"github.com/contactkeval/expressioneval/tokenizer"
+)
+
+// A node in the syntax tree of a parsed expression. Nodes are never modified
+// by the evaluator, so a tree can be inspected and evaluated any number of
+// times.
+type Node interface {
+	// String returns the expression represented by the node in a normalized,
+	// fully parenthesized form
+	String() string
+
+	// The part of the expression the node was parsed from
+	SourceSpan() tokenizer.Span
+}
+
+// Embedded in all nodes to record where they are in the expression
+type Loc struct {
+	Span tokenizer.Span
+}
+
+func (l Loc) SourceSpan() tokenizer.Span { return l.Span }
+
+// A literal value such as 10, 1.5, "abc", 'c' or true
+type Literal struct {
+	Loc
+	Value datatype.DataType
+}
+
+// A reference to a symbol in the symbol table
+type Symbol struct {
+	Loc
+	Name string
+}
+
+// A prefix operator applied to a single operand: !, - and +
+type Unary struct {
+	Loc
+	Op      string
+	Operand Node
+}
+
+// An infix operator applied to two operands. Besides the arithmetic,
+// relational and logical operators this includes ':' which builds an IntRange.
+type Binary struct {
+	Loc
+	Op          string
+	Left, Right Node
+}
+
+// A call to an intrinsic method
+type Call struct {
+	Loc
+	Name string
+	Args []Node
+}
+
+// A list built with [a, b, ...]
+type List struct {
+	Loc
+	Items []Node
+}
+
+// A map built with @{"key": value, ...}. Keys are in source order.
+type Map struct {
+	Loc
+	Keys   []string
+	Values []Node
+}
+
+// Indexing or slicing a list or string with value{index}
+type Index struct {
+	Loc
+	Target, Index Node
+}
+
+// Access to a named member of a value with value.Name
+type Member struct {
+	Loc
+	Target Node
+	Name   string
+}
+
+// A conditional expression that evaluates to True or False based on Cond,
+// written as cond ? a : b or in the legacy form ?(cond : a, b). Only one of
+// the branches is ever needed.
+type Conditional struct {
+	Loc
+	Cond, True, False Node
+}
+
+// A type cast such as <I> or <String>. DataType is one of the data type names
+// in the datatype package.
+type Cast struct {
+	Loc
+	DataType string
+	Operand  Node
+}
+
+func (n *Literal) String() string {
+	switch v := n.Value.(type) {
+	case datatype.String:
+		return fmt.Sprintf("%q", string(v))
+	case datatype.Char:
+		return fmt.Sprintf("%q", rune(v))
+	case datatype.Double:
+		s := strconv.FormatFloat(float64(v), 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	case datatype.Decimal:
+		return v.ToPrint() + "M"
+	case datatype.Bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	default:
+		return datatype.ToPrint(v)
+	}
+}
+
+func (n *Symbol) String() string { return n.Name }
+
+func (n *Unary) String() string {
+	return fmt.Sprintf("(%s%s)", n.Op, n.Operand)
+}
+
+func (n *Binary) String() string {
+	return fmt.Sprintf("(%s %s %s)", n.Left, n.Op, n.Right)
+}
+
+func (n *Call) String() string {
+	return fmt.Sprintf("%s(%s)", n.Name, joinNodes(n.Args))
+}
+
+func (n *List) String() string {
+	return fmt.Sprintf("[%s]", joinNodes(n.Items))
+}
+
+func (n *Map) String() string {
+	parts := make([]string, len(n.Keys))
+	for i, k := range n.Keys {
+		parts[i] = fmt.Sprintf("%q: %s", k, n.Values[i])
+	}
+	return fmt.Sprintf("@{%s}", strings.Join(parts, ", "))
+}
+
+func (n *Index) String() string {
+	return fmt.Sprintf("%s{%s}", n.Target, n.Index)
+}
+
+func (n *Member) String() string {
+	return fmt.Sprintf("%s.%s", n.Target, n.Name)
+}
+
+func (n *Conditional) String() string {
+	return fmt.Sprintf("(%s ? %s : %s)", n.Cond, n.True, n.False)
+}
+
+func (n *Cast) String() string {
+	return fmt.Sprintf("(<%s>%s)", n.DataType, n.Operand)
+}
+
+func joinNodes(nodes []Node) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = n.String()
+	}
+	return strings.Join(parts, ", ")
+}
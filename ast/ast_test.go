@@ -0,0 +1,95 @@
+package ast_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/contactkeval/expressioneval/ast"
+	"github.com/contactkeval/expressioneval/parser"
+	"github.com/contactkeval/expressioneval/tokenizer"
+)
+
+func parse(t *testing.T, text string) ast.Node {
+	t.Helper()
+	tokens, err := tokenizer.Tokenize(text)
+	if err != nil {
+		t.Fatalf("Tokenize(%q): %v", text, err)
+	}
+	n, err := parser.Parse(tokens)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", text, err)
+	}
+	return n
+}
+
+// The fully parenthesized form of a tree parses back to the same tree
+func TestStringRoundTrips(t *testing.T) {
+	tests := []string{
+		"a + b * c - d # e",
+		"a < b && c >= d || !e",
+		"a ?? b ?? c || d",
+		"a ? b : c ? d : e",
+		"-a ^ b / <D>c",
+		"Max([1, 2.5, 3M], x{1:2}) + \"s\"{0}",
+		"@{\"a\": 1, \"b\": [x]}.a",
+		"Order.Total * 'c'",
+	}
+	for _, text := range tests {
+		want := parse(t, text).String()
+		if got := parse(t, want).String(); got != want {
+			t.Errorf("%s: %s parsed back as %s", text, want, got)
+		}
+	}
+}
+
+func TestChildrenAreInSourceOrder(t *testing.T) {
+	n := parse(t, "a ? b + c : Max(d, e{f})")
+
+	var visited []string
+	ast.Inspect(n, func(n ast.Node) bool {
+		visited = append(visited, n.String())
+		return true
+	})
+
+	want := []string{
+		"(a ? (b + c) : Max(d, e{f}))",
+		"a",
+		"(b + c)",
+		"b",
+		"c",
+		"Max(d, e{f})",
+		"d",
+		"e{f}",
+		"e",
+		"f",
+	}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("visited %q, want %q", visited, want)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	n := parse(t, "Max(a, b) + c")
+
+	var symbols []string
+	ast.Inspect(n, func(n ast.Node) bool {
+		if _, ok := n.(*ast.Call); ok {
+			return false
+		}
+		if s, ok := n.(*ast.Symbol); ok {
+			symbols = append(symbols, s.Name)
+		}
+		return true
+	})
+
+	if !reflect.DeepEqual(symbols, []string{"c"}) {
+		t.Errorf("symbols outside calls = %q, want [c]", symbols)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	got := ast.Symbols(parse(t, "b + a * b - Max(c, a)"))
+	if want := []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Symbols = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package ast
+
+// Inspect traverses the tree rooted at n in depth-first order, calling f for
+// each node. If f returns false, the children of that node are skipped.
+func Inspect(n Node, f func(Node) bool) {
+	if n == nil || !f(n) {
+		return
+	}
+
+	for _, c := range Children(n) {
+		Inspect(c, f)
+	}
+}
+
+// Children returns the direct child nodes of n in source order
+func Children(n Node) []Node {
+	switch v := n.(type) {
+	case *Unary:
+		return []Node{v.Operand}
+	case *Binary:
+		return []Node{v.Left, v.Right}
+	case *Call:
+		return v.Args
+	case *List:
+		return v.Items
+	case *Map:
+		return v.Values
+	case *Index:
+		return []Node{v.Target, v.Index}
+	case *Member:
+		return []Node{v.Target}
+	case *Conditional:
+		return []Node{v.Cond, v.True, v.False}
+	case *Cast:
+		return []Node{v.Operand}
+	}
+	return nil
+}
+
+// Symbols returns the names of all symbols referenced in the tree, in the
+// order they first appear
+func Symbols(n Node) []string {
+	var names []string
+	seen := map[string]bool{}
+
+	Inspect(n, func(n Node) bool {
+		if s, ok := n.(*Symbol); ok && !seen[s.Name] {
+			seen[s.Name] = true
+			names = append(names, s.Name)
+		}
+		return true
+	})
+
+	return names
+}
@@ -25,6 +25,15 @@ func ToDateTime(d DataType) (DateTime, error) {
 		return DateTime(time.Now()), fmt.Errorf("Cannot convert '%v' to DateTime", d)
 	}
 }
+func ToDuration(d DataType) (Duration, error) {
+	if v, ok := d.(interface {
+		ToDuration() (Duration, error)
+	}); ok {
+		return v.ToDuration()
+	} else {
+		return 0, fmt.Errorf("Cannot convert '%v' to Duration", d)
+	}
+}
 func ToInt(d DataType) (Int, error) {
 	if v, ok := d.(interface {
 		ToInt() (Int, error)
@@ -43,6 +52,15 @@ func ToDouble(d DataType) (Double, error) {
 		return 0, fmt.Errorf("Cannot convert '%v' to Double", d)
 	}
 }
+func ToDecimal(d DataType) (Decimal, error) {
+	if v, ok := d.(interface {
+		ToDecimal() (Decimal, error)
+	}); ok {
+		return v.ToDecimal()
+	} else {
+		return Decimal{}, fmt.Errorf("Cannot convert '%v' to Decimal", d)
+	}
+}
 func ToString(d DataType) (String, error) {
 	if v, ok := d.(interface {
 		ToString() (String, error)
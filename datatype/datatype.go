@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // Data type names. DataType tokens return one of these when their DataType()
@@ -13,11 +14,13 @@ const (
 	DataTypeBool              = "Bool"
 	DataTypeString            = "String"
 	DataTypeDouble            = "Double"
+	DataTypeDecimal           = "Decimal"
 	DataTypeInt               = "Int32"
 	DataTypeChar              = "Char"
 	DataTypeDateTime          = "DateTime"
 	DataTypeIntRange          = "IntRange"
 	DataTypeConditionalValues = "ConditionalValues"
+	DataTypeNull              = "Null"
 )
 
 // All values should be a DatatType
@@ -38,8 +41,21 @@ type ConditionalValues struct {
 	True, False DataType
 }
 
-// Null doesn't seem to have been implemented properly in the C# code
-// type Null struct{}
+// The absence of a value, eg. an optional field that isn't set. Null
+// propagates through expressions:
+//
+//   - Arithmetic and the <, >, <= and >= comparisons give null if either
+//     operand is null. So do unary minus, casts, indexing and member access.
+//   - = and <> treat null as a value that is only equal to null.
+//   - &&, || and ! use three-valued logic: null && false is false, null ||
+//     true is true, and the other combinations with null give null.
+//   - A null condition picks the false branch of a conditional.
+//   - Lists keep null items. They are skipped when converting the items and
+//     by the methods that take a list of numbers or strings.
+//   - An intrinsic method that has no signature for a null argument returns
+//     null.
+//   - a ?? b gives b if a is null, and a otherwise.
+type Null struct{}
 
 // Data types can implement this interface to specify how they should be
 // printed on screen
@@ -75,17 +91,78 @@ func (b Bool) ToDouble() (Double, error) {
 	}
 }
 
+/////////////////////////////
+// Null
+func (n Null) DataType() string { return DataTypeNull }
+func (n Null) ToPrint() string {
+	return "null"
+}
+
 /////////////////////////////
 // DateTime
+
 func (b DateTime) DataType() string { return DataTypeDateTime }
 func (n DateTime) ToDateTime() (DateTime, error) {
 	return n, nil
 }
 func (n DateTime) ToString() (String, error) {
-	return String(time.Time(n).Format("01/02/2006")), nil
+	return String(n.ToPrint()), nil
 }
+
+// A DateTime is printed in the RFC 3339 form 2006-01-02T15:04:05+01:00, which
+// has the offset from UTC, so parsing the text gives back the same instant in
+// any time zone
 func (n DateTime) ToPrint() string {
-	return time.Time(n).Format("01/02/2006")
+	return time.Time(n).Format(time.RFC3339Nano)
+}
+
+// Midnight at the start of the day
+func (n DateTime) date() time.Time {
+	t := time.Time(n)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// The DateTime at midnight at the start of the day
+func (n DateTime) Date() DateTime {
+	return DateTime(n.date())
+}
+
+// The parts of the date and the time of day, eg. Year, Hour or DayOfWeek
+// (0 is Sunday). Date is the DateTime at midnight and TimeOfDay the wall
+// clock Duration since midnight. TimeZone is the name of the time zone and Offset its
+// Duration from UTC.
+func (n DateTime) Member(name string) (DataType, bool, error) {
+	t := time.Time(n)
+	switch name {
+	case "Year":
+		return Int(t.Year()), true, nil
+	case "Month":
+		return Int(t.Month()), true, nil
+	case "Day":
+		return Int(t.Day()), true, nil
+	case "Hour":
+		return Int(t.Hour()), true, nil
+	case "Minute":
+		return Int(t.Minute()), true, nil
+	case "Second":
+		return Int(t.Second()), true, nil
+	case "Millisecond":
+		return Int(t.Nanosecond() / int(time.Millisecond)), true, nil
+	case "DayOfWeek":
+		return Int(t.Weekday()), true, nil
+	case "DayOfYear":
+		return Int(t.YearDay()), true, nil
+	case "Date":
+		return n.Date(), true, nil
+	case "TimeOfDay":
+		return Duration(n.Sub(n.Date())), true, nil
+	case "TimeZone":
+		return String(t.Location().String()), true, nil
+	case "Offset":
+		_, offset := t.Zone()
+		return Duration(time.Duration(offset) * time.Second), true, nil
+	}
+	return nil, false, nil
 }
 
 /////////////////////////////
@@ -157,7 +234,11 @@ func (s String) ToBool() (Bool, error) {
 	return false, fmt.Errorf("Cannot convert '%s' to Bool", s)
 }
 func (s String) ToChar() (Char, error) {
-	return Char(s[0]), nil
+	if len(s) == 0 {
+		return 0, fmt.Errorf("Cannot convert an empty String to Char")
+	}
+	r, _ := utf8.DecodeRuneInString(string(s))
+	return Char(r), nil
 }
 func (s String) ToString() (String, error) {
 	return s, nil
@@ -180,9 +261,10 @@ func (s String) ToDouble() (Double, error) {
 	}
 }
 
+// Parse s with the DefaultDateTimeLayouts in the local time zone. Expressions
+// parse text with the layouts and time zone of their environment instead.
 func (s String) ToDateTime() (DateTime, error) {
-	t, err := time.Parse("01/02/2006", string(s))
-	return DateTime(t), err
+	return ParseDateTime(string(s), DefaultDateTimeLayouts, time.Local)
 }
 
 /////////////////////////////
@@ -0,0 +1,341 @@
+package datatype
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const isoDateLayout = "2006-01-02"
+
+// The layouts, in the syntax of the time package, that are accepted when a
+// String is converted to a DateTime: RFC 3339 and ISO 8601 dates and times,
+// and the US month/day/year format.
+var DefaultDateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	isoDateLayout,
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+	"01/02/2006",
+}
+
+// Parse a DateTime with the first of the layouts that matches s. Text without
+// a time zone offset is in loc.
+func ParseDateTime(s string, layouts []string, loc *time.Location) (DateTime, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return DateTime(t), nil
+		}
+	}
+	return DateTime{}, fmt.Errorf("Cannot convert '%s' to DateTime", s)
+}
+
+// Find a time zone by its IANA name, eg. Europe/Paris, or by its offset from
+// UTC, eg. +05:30. UTC and Local are also accepted.
+func LoadLocation(name string) (*time.Location, error) {
+	if strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-") {
+		if offset, ok := parseOffset(name[1:]); ok {
+			if name[0] == '-' {
+				offset = -offset
+			}
+			return time.FixedZone(name, offset), nil
+		}
+		return nil, fmt.Errorf("Invalid time zone offset '%s'", name)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "" {
+		return nil, fmt.Errorf("Unknown time zone '%s'", name)
+	}
+	return loc, nil
+}
+
+// The seconds of an offset in the form hh:mm, hhmm or hh
+func parseOffset(s string) (int, bool) {
+	s = strings.Replace(s, ":", "", 1)
+	if len(s) != 2 && len(s) != 4 || strings.Trim(s, "0123456789") != "" {
+		return 0, false
+	}
+	h, err := strconv.Atoi(s[:2])
+	if err != nil || h > 23 {
+		return 0, false
+	}
+	m := 0
+	if len(s) == 4 {
+		if m, err = strconv.Atoi(s[2:]); err != nil || m > 59 {
+			return 0, false
+		}
+	}
+	return h*3600 + m*60, true
+}
+
+// A unit of calendar arithmetic, see DateTime.Add and DateTime.Diff
+type DateUnit int
+
+const (
+	UnitYear DateUnit = iota
+	UnitQuarter
+	UnitMonth
+	UnitWeek
+	UnitDay
+	UnitBusinessDay
+	UnitHour
+	UnitMinute
+	UnitSecond
+)
+
+var dateUnitNames = map[string]DateUnit{
+	"year":        UnitYear,
+	"quarter":     UnitQuarter,
+	"month":       UnitMonth,
+	"week":        UnitWeek,
+	"day":         UnitDay,
+	"businessday": UnitBusinessDay,
+	"hour":        UnitHour,
+	"minute":      UnitMinute,
+	"second":      UnitSecond,
+}
+
+// Get a date unit from its name, eg. "month" or "businessday". The plural,
+// eg. "months", is accepted too.
+func ParseDateUnit(name string) (DateUnit, error) {
+	if u, ok := dateUnitNames[strings.TrimSuffix(strings.ToLower(name), "s")]; ok {
+		return u, nil
+	}
+	return 0, fmt.Errorf("Unknown date unit '%s'", name)
+}
+
+// The units that have a fixed length
+var clockUnits = map[DateUnit]time.Duration{UnitHour: time.Hour, UnitMinute: time.Minute, UnitSecond: time.Second}
+
+// Calendar arithmetic is limited to about this many years, which keeps the
+// results in the range of the time package
+const maxYears = 10000
+
+// The most days that are stepped through when counting business days, which
+// is 400 years
+const maxBusinessDaySpan = 146097
+
+var errDateRange = fmt.Errorf("Date out of range")
+
+// Add count units to n. Adding months doesn't overflow into the next month,
+// so January 31 plus a month is the last day of February. Hours, minutes and
+// seconds are added to the wall clock time as by AddDuration. Business days
+// are the weekdays, use AddBusinessDays for other business days.
+func (n DateTime) Add(count int, unit DateUnit) (DateTime, error) {
+	t := time.Time(n)
+	switch unit {
+	case UnitYear:
+		return addMonths(t, count, 12)
+	case UnitQuarter:
+		return addMonths(t, count, 3)
+	case UnitMonth:
+		return addMonths(t, count, 1)
+	case UnitWeek:
+		return addDays(t, count, 7)
+	case UnitDay:
+		return addDays(t, count, 1)
+	case UnitBusinessDay:
+		return n.AddBusinessDays(count, IsWeekday)
+	}
+
+	d, ok := clockUnits[unit]
+	if !ok {
+		return DateTime{}, fmt.Errorf("Unknown date unit %d", unit)
+	}
+	if limit := time.Duration(math.MaxInt64) / d; time.Duration(count) > limit || time.Duration(count) < -limit {
+		return DateTime{}, errDateRange
+	}
+	return n.AddDuration(time.Duration(count) * d), nil
+}
+
+// The wall clock time of t, ie. its date and time of day, as a time in UTC.
+// Wall clock times are a whole number of days apart if they have the same
+// time of day, even if a daylight saving time change is between them.
+func wallClock(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// The wall clock time from start to n, with start converted to the time zone
+// of n. So from midnight to midnight of the next day is always 24 hours, even
+// if the day is only 23 hours long because of daylight saving time. The
+// result saturates at the largest or smallest Duration.
+func (n DateTime) Sub(start DateTime) time.Duration {
+	t := time.Time(n)
+	return wallClock(t).Sub(wallClock(time.Time(start).In(t.Location())))
+}
+
+// Add d to the wall clock time of n, in the time zone of n. This is the
+// inverse of Sub, so n.AddDuration(end.Sub(n)) is end. A wall clock time that
+// is skipped when daylight saving time starts is moved forward by the length
+// of the gap.
+func (n DateTime) AddDuration(d time.Duration) DateTime {
+	t := time.Time(n)
+	w := wallClock(t).Add(d)
+	y, m, day := w.Date()
+	return DateTime(time.Date(y, m, day, w.Hour(), w.Minute(), w.Second(), w.Nanosecond(), t.Location()))
+}
+
+// Add count × per months to t
+func addMonths(t time.Time, count, per int) (DateTime, error) {
+	if limit := maxYears * 12 / per; count > limit || count < -limit {
+		return DateTime{}, errDateRange
+	}
+	return DateTime(shiftMonths(t, count*per)), nil
+}
+
+// Add count × per days to t
+func addDays(t time.Time, count, per int) (DateTime, error) {
+	if limit := maxYears * 366 / per; count > limit || count < -limit {
+		return DateTime{}, errDateRange
+	}
+	return DateTime(t.AddDate(0, 0, count*per)), nil
+}
+
+// t plus a number of months, on the last day of the month if the month is
+// shorter than the day of t
+func shiftMonths(t time.Time, months int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	if last := daysInMonth(first); d > last {
+		d = last
+	}
+	return time.Date(first.Year(), first.Month(), d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// The number of days in the month of t
+func daysInMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// The number of whole units from n to end, which is negative if end is
+// before n. Eg. there is 1 month from January 31 to February 29, but none
+// from January 15 to February 14. Hours, minutes and seconds are counted in
+// wall clock time as by Sub, so they agree with Add. Business days are
+// counted as in BusinessDaysUntil, with the weekdays as the business days.
+func (n DateTime) Diff(end DateTime, unit DateUnit) (int, error) {
+	a, b := time.Time(n), time.Time(end).In(time.Time(n).Location())
+	switch unit {
+	case UnitYear:
+		return monthsBetween(a, b) / 12, nil
+	case UnitQuarter:
+		return monthsBetween(a, b) / 3, nil
+	case UnitMonth:
+		return monthsBetween(a, b), nil
+	case UnitWeek:
+		return daysBetween(a, b) / 7, nil
+	case UnitDay:
+		return daysBetween(a, b), nil
+	case UnitBusinessDay:
+		return n.BusinessDaysUntil(end, IsWeekday)
+	}
+
+	d, ok := clockUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("Unknown date unit %d", unit)
+	}
+	return int(DateTime(b).Sub(n) / d), nil
+}
+
+func monthsBetween(a, b time.Time) int {
+	months := (b.Year()-a.Year())*12 + int(b.Month()) - int(a.Month())
+	// The last month isn't whole if b is earlier in the month than a
+	if months > 0 && shiftMonths(a, months).After(b) {
+		months--
+	} else if months < 0 && shiftMonths(a, months).Before(b) {
+		months++
+	}
+	return months
+}
+
+func daysBetween(a, b time.Time) int {
+	days := calendarDays(a, b)
+	// The last day isn't whole if b is earlier in the day than a
+	if days > 0 && a.AddDate(0, 0, days).After(b) {
+		days--
+	} else if days < 0 && a.AddDate(0, 0, days).Before(b) {
+		days++
+	}
+	return days
+}
+
+// The number of days from the date of a to the date of b, ignoring the time
+// of day
+func calendarDays(a, b time.Time) int {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	secs := time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC).Unix() - time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC).Unix()
+	return int(secs / (24 * 60 * 60))
+}
+
+// Monday to Friday are the business days, unless a calendar says otherwise
+func IsWeekday(t time.Time) bool {
+	wd := t.Weekday()
+	return wd != time.Saturday && wd != time.Sunday
+}
+
+// Add count business days to n, eg. 1 business day after a Friday is the
+// next Monday if the weekdays are the business days. The time of day is kept.
+func (n DateTime) AddBusinessDays(count int, isBusinessDay func(time.Time) bool) (DateTime, error) {
+	t, step := time.Time(n), 1
+	if count < 0 {
+		count, step = -count, -1
+	}
+	for days := 0; count > 0; days++ {
+		if days == maxBusinessDaySpan {
+			return DateTime{}, errDateRange
+		}
+		t = t.AddDate(0, 0, step)
+		if isBusinessDay(t) {
+			count--
+		}
+	}
+	return DateTime(t), nil
+}
+
+// The number of business days after the date of n up to and including the
+// date of end. If end is before n, it is minus the number of business days
+// from end up to the day before n. So adding the result to n gives end if
+// end is a business day.
+func (n DateTime) BusinessDaysUntil(end DateTime, isBusinessDay func(time.Time) bool) (int, error) {
+	start := time.Time(n)
+	days := calendarDays(start, time.Time(end).In(start.Location()))
+	if days > maxBusinessDaySpan || days < -maxBusinessDaySpan {
+		return 0, errDateRange
+	}
+
+	count := 0
+	for i := 1; i <= days; i++ {
+		if isBusinessDay(start.AddDate(0, 0, i)) {
+			count++
+		}
+	}
+	for i := days; i < 0; i++ {
+		if isBusinessDay(start.AddDate(0, 0, i)) {
+			count--
+		}
+	}
+	return count, nil
+}
+
+// Midnight at the start of the first and the last day of the month of n
+func (n DateTime) StartOfMonth() DateTime {
+	t := time.Time(n)
+	return DateTime(time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()))
+}
+func (n DateTime) EndOfMonth() DateTime {
+	t := time.Time(n)
+	return DateTime(time.Date(t.Year(), t.Month(), daysInMonth(t), 0, 0, 0, 0, t.Location()))
+}
+
+func IsLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
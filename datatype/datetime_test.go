@@ -0,0 +1,135 @@
+package datatype
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParseDateTime(t *testing.T, s string, loc *time.Location) DateTime {
+	t.Helper()
+	dt, err := ParseDateTime(s, DefaultDateTimeLayouts, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dt
+}
+
+func TestDateTimeAdd(t *testing.T) {
+	tests := []struct {
+		start string
+		count int
+		unit  DateUnit
+		want  string
+	}{
+		// Months are clamped to the last day of the month
+		{"2024-01-31", 1, UnitMonth, "2024-02-29T00:00:00Z"},
+		{"2023-01-31", 1, UnitMonth, "2023-02-28T00:00:00Z"},
+		{"2024-03-31", -1, UnitMonth, "2024-02-29T00:00:00Z"},
+		{"2024-12-31", 2, UnitMonth, "2025-02-28T00:00:00Z"},
+		{"2024-01-30", 1, UnitMonth, "2024-02-29T00:00:00Z"},
+		{"2024-02-29", 1, UnitMonth, "2024-03-29T00:00:00Z"},
+		{"2024-02-29", 1, UnitYear, "2025-02-28T00:00:00Z"},
+		{"2024-02-29", 4, UnitYear, "2028-02-29T00:00:00Z"},
+		{"2024-05-31", 1, UnitQuarter, "2024-08-31T00:00:00Z"},
+		{"2024-08-31", -2, UnitQuarter, "2024-02-29T00:00:00Z"},
+		{"2024-01-31T10:30:00Z", 1, UnitMonth, "2024-02-29T10:30:00Z"},
+
+		{"2024-03-15", 2, UnitWeek, "2024-03-29T00:00:00Z"},
+		{"2024-03-15", -15, UnitDay, "2024-02-29T00:00:00Z"},
+		{"2024-03-15", 0, UnitDay, "2024-03-15T00:00:00Z"},
+		{"2024-03-15", 1, UnitBusinessDay, "2024-03-18T00:00:00Z"},
+		{"2024-03-15T23:00:00Z", 2, UnitHour, "2024-03-16T01:00:00Z"},
+		{"2024-03-15", -90, UnitMinute, "2024-03-14T22:30:00Z"},
+		{"2024-03-15", 61, UnitSecond, "2024-03-15T00:01:01Z"},
+	}
+	for _, tt := range tests {
+		got, err := mustParseDateTime(t, tt.start, time.UTC).Add(tt.count, tt.unit)
+		if err != nil || got.ToPrint() != tt.want {
+			t.Errorf("%s + %d × unit %d = %s, %v, want %s", tt.start, tt.count, tt.unit, got.ToPrint(), err, tt.want)
+		}
+	}
+
+	start := mustParseDateTime(t, "2024-03-15", time.UTC)
+	for _, unit := range []DateUnit{UnitYear, UnitMonth, UnitDay, UnitHour} {
+		if _, err := start.Add(1<<40, unit); err != errDateRange {
+			t.Errorf("adding 1<<40 × unit %d: error %v, want %v", unit, err, errDateRange)
+		}
+	}
+}
+
+func TestDateTimeDiff(t *testing.T) {
+	tests := []struct {
+		start, end string
+		unit       DateUnit
+		want       int
+	}{
+		{"2024-01-31", "2024-02-29", UnitMonth, 1},
+		{"2024-01-15", "2024-02-14", UnitMonth, 0},
+		{"2024-01-15", "2024-02-15", UnitMonth, 1},
+		{"2024-03-31", "2024-01-31", UnitMonth, -2},
+		{"2024-03-15", "2024-01-16", UnitMonth, -1},
+		{"2024-02-29", "2025-02-28", UnitYear, 1},
+		{"2024-02-29", "2028-02-29", UnitYear, 4},
+		{"2024-03-01", "2025-02-28", UnitYear, 0},
+		{"2024-01-01", "2024-12-31", UnitQuarter, 3},
+		{"2024-01-01", "2024-01-15", UnitWeek, 2},
+		{"2024-01-15", "2024-01-01", UnitWeek, -2},
+		{"2024-01-01", "2024-01-14", UnitWeek, 1},
+		{"2024-01-01T10:00:00Z", "2024-01-02T09:00:00Z", UnitDay, 0},
+		{"2024-01-01T10:00:00Z", "2024-01-02T10:00:00Z", UnitDay, 1},
+		{"2024-01-02T09:00:00Z", "2024-01-01T10:00:00Z", UnitDay, 0},
+		{"2024-01-01T10:00:00Z", "2024-01-02T09:00:00Z", UnitHour, 23},
+		{"2024-01-01T10:00:00Z", "2024-01-01T10:01:30Z", UnitMinute, 1},
+		{"2024-01-01T10:00:00Z", "2024-01-01T10:01:30Z", UnitSecond, 90},
+		{"2024-01-01T10:01:30Z", "2024-01-01T10:00:00Z", UnitMinute, -1},
+		{"2024-03-15", "2024-03-22", UnitBusinessDay, 5},
+	}
+	for _, tt := range tests {
+		got, err := mustParseDateTime(t, tt.start, time.UTC).Diff(mustParseDateTime(t, tt.end, time.UTC), tt.unit)
+		if err != nil || got != tt.want {
+			t.Errorf("%s to %s in unit %d = %d, %v, want %d", tt.start, tt.end, tt.unit, got, err, tt.want)
+		}
+	}
+}
+
+// Hours, minutes and seconds are wall clock time in Add, Diff and Sub alike,
+// so a day is 24 hours even when daylight saving time makes it 23 or 25
+func TestDateTimeWallClockAcrossDST(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	parse := func(s string) DateTime { return mustParseDateTime(t, s, paris) }
+
+	tests := []struct {
+		start, end string
+		hours      int
+	}{
+		// Daylight saving time starts at 02:00 on 2024-03-31
+		{"2024-03-30T12:00:00", "2024-03-31T12:00:00", 24},
+		// and ends at 03:00 on 2024-10-27
+		{"2024-10-26T12:00:00", "2024-10-27T12:00:00", 24},
+		{"2024-03-31T00:00:00", "2024-04-01T00:00:00", 24},
+		{"2024-03-31T12:00:00", "2024-03-30T12:00:00", -24},
+	}
+	for _, tt := range tests {
+		start, end := parse(tt.start), parse(tt.end)
+		if got, err := start.Diff(end, UnitHour); err != nil || got != tt.hours {
+			t.Errorf("hours from %s to %s = %d, %v, want %d", tt.start, tt.end, got, err, tt.hours)
+		}
+		if got := end.Sub(start); got != time.Duration(tt.hours)*time.Hour {
+			t.Errorf("%s - %s = %s, want %dh", tt.end, tt.start, got, tt.hours)
+		}
+		if got, err := start.Add(tt.hours, UnitHour); err != nil || !time.Time(got).Equal(time.Time(end)) {
+			t.Errorf("%s + %d hours = %s, %v, want %s", tt.start, tt.hours, got.ToPrint(), err, end.ToPrint())
+		}
+		if got, err := start.Diff(end, UnitDay); err != nil || got != tt.hours/24 {
+			t.Errorf("days from %s to %s = %d, %v, want %d", tt.start, tt.end, got, err, tt.hours/24)
+		}
+	}
+
+	// 02:30 is skipped when daylight saving time starts
+	if got, _ := parse("2024-03-31T01:30:00").Add(1, UnitHour); got.ToPrint() != "2024-03-31T03:30:00+02:00" {
+		t.Errorf("01:30 + 1 hour = %s, want 03:30", got.ToPrint())
+	}
+}
@@ -0,0 +1,372 @@
+package datatype
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// An arbitrary precision decimal number, for calculations on money that have
+// to be exact. The value is coef × 10^-scale, eg. 10.50 has the coefficient
+// 1050 and the scale 2. The coefficient is kept as text so that Decimals can
+// be compared with == and used as map keys, like the other data types.
+type Decimal struct {
+	coef  string // The unscaled value in base 10, "" is 0
+	scale int    // The number of digits after the decimal point
+}
+
+// How to round a Decimal that has more digits than are kept
+type RoundingMode int
+
+const (
+	RoundHalfEven RoundingMode = iota // To the nearest, ties to the even digit
+	RoundHalfUp                       // To the nearest, ties away from zero
+	RoundDown                         // Towards zero, ie. truncate
+)
+
+var roundingModeNames = map[string]RoundingMode{
+	"halfeven": RoundHalfEven,
+	"halfup":   RoundHalfUp,
+	"down":     RoundDown,
+}
+
+// Get a rounding mode from its name, eg. "HalfEven", "HalfUp" or "Down"
+func ParseRoundingMode(name string) (RoundingMode, error) {
+	if m, ok := roundingModeNames[strings.ToLower(name)]; ok {
+		return m, nil
+	}
+	return 0, fmt.Errorf("Unknown rounding mode '%s'", name)
+}
+
+// Settings for the Decimal operations that can't be exact
+type DecimalContext struct {
+	DivisionScale int          // Digits after the decimal point kept when dividing
+	Rounding      RoundingMode // Used when dividing and by default when rounding
+}
+
+// The settings used by the Decimal operators and intrinsic methods if the
+// environment doesn't set any
+func DefaultDecimalContext() DecimalContext {
+	return DecimalContext{DivisionScale: 16, Rounding: RoundHalfEven}
+}
+
+// Limits on the size of Decimals, so that a value like 1e100000000 can't use
+// up all memory and time. Operations with a larger result return
+// ErrDecimalRange.
+const (
+	MaxDecimalDigits = 1000 // Digits of the coefficient
+	MaxDecimalScale  = 1000 // Digits after the decimal point
+)
+
+// Returned for a Decimal with more digits than MaxDecimalDigits or a scale
+// larger than MaxDecimalScale
+var ErrDecimalRange = fmt.Errorf("Decimal out of range")
+
+func newDecimal(coef *big.Int, scale int) Decimal {
+	return Decimal{coef: coef.String(), scale: scale}
+}
+
+// Create a Decimal with the value coef × 10^-scale
+func NewDecimal(coef int64, scale int) Decimal {
+	return newDecimal(big.NewInt(coef), scale)
+}
+
+// Parse the text of a decimal number, eg. "-10.50" or "1.5e3". Returns
+// ErrDecimalRange if the number is too large or has too many digits.
+func ParseDecimal(s string) (Decimal, error) {
+	invalid := fmt.Errorf("Cannot convert '%s' to Decimal", s)
+
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return Decimal{}, invalid
+		}
+		mantissa, exp = s[:i], e
+	}
+	if exp > MaxDecimalDigits || exp < -MaxDecimalScale-len(mantissa) {
+		return Decimal{}, ErrDecimalRange
+	}
+
+	digits, scale := mantissa, 0
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		digits, scale = mantissa[:i]+mantissa[i+1:], len(mantissa)-i-1
+	}
+
+	unsigned := strings.TrimLeft(digits, "+-")
+	if unsigned == "" || strings.IndexFunc(unsigned, func(r rune) bool { return r < '0' || r > '9' }) >= 0 || len(digits)-len(unsigned) > 1 {
+		return Decimal{}, invalid
+	}
+
+	coef, _ := new(big.Int).SetString(digits, 10)
+	scale -= exp
+	if scale < 0 {
+		coef.Mul(coef, pow10(-scale))
+		scale = 0
+	}
+	d := newDecimal(coef, scale)
+	if err := d.CheckRange(); err != nil {
+		return Decimal{}, err
+	}
+	return d, nil
+}
+
+// The number of digits of the coefficient of d, eg. 4 for 10.50
+func (d Decimal) Digits() int {
+	return len(strings.TrimLeft(d.coef, "-"))
+}
+
+// Returns ErrDecimalRange if d has more digits or a larger scale than
+// Decimals are allowed to have
+func (d Decimal) CheckRange() error {
+	if d.Digits() > MaxDecimalDigits || d.scale > MaxDecimalScale {
+		return ErrDecimalRange
+	}
+	return nil
+}
+
+// The value of d as a big.Int
+func (d Decimal) unscaled() *big.Int {
+	coef, ok := new(big.Int).SetString(d.coef, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return coef
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// The coefficients of d and e scaled to the larger of their scales
+func align(d, e Decimal) (*big.Int, *big.Int, int) {
+	a, b := d.unscaled(), e.unscaled()
+	switch {
+	case d.scale < e.scale:
+		a.Mul(a, pow10(e.scale-d.scale))
+		return a, b, e.scale
+	case d.scale > e.scale:
+		b.Mul(b, pow10(d.scale-e.scale))
+	}
+	return a, b, d.scale
+}
+
+// Round the quotient q of a division with remainder r and divisor den
+func roundQuotient(q, r, den *big.Int, mode RoundingMode) *big.Int {
+	if r.Sign() == 0 || mode == RoundDown {
+		return q
+	}
+
+	// Compare the remainder with half of the divisor
+	twice := new(big.Int).Abs(r)
+	twice.Lsh(twice, 1)
+	c := twice.Cmp(new(big.Int).Abs(den))
+
+	if c > 0 || (c == 0 && (mode == RoundHalfUp || q.Bit(0) == 1)) {
+		if r.Sign() != den.Sign() {
+			return q.Sub(q, big.NewInt(1))
+		}
+		return q.Add(q, big.NewInt(1))
+	}
+	return q
+}
+
+func (d Decimal) Add(e Decimal) Decimal {
+	a, b, scale := align(d, e)
+	return newDecimal(a.Add(a, b), scale)
+}
+
+func (d Decimal) Sub(e Decimal) Decimal {
+	a, b, scale := align(d, e)
+	return newDecimal(a.Sub(a, b), scale)
+}
+
+func (d Decimal) Mul(e Decimal) Decimal {
+	a := d.unscaled()
+	return newDecimal(a.Mul(a, e.unscaled()), d.scale+e.scale)
+}
+
+// Returned when dividing a Decimal by zero
+var ErrDivisionByZero = fmt.Errorf("Division by zero")
+
+// Divide d by e, keeping scale digits after the decimal point
+func (d Decimal) Quo(e Decimal, scale int, mode RoundingMode) (Decimal, error) {
+	den := e.unscaled()
+	if den.Sign() == 0 {
+		return Decimal{}, ErrDivisionByZero
+	}
+
+	num := d.unscaled()
+	if k := scale - d.scale + e.scale; k >= 0 {
+		num.Mul(num, pow10(k))
+	} else {
+		den.Mul(den, pow10(-k))
+	}
+
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	return newDecimal(roundQuotient(q, r, den, mode), scale), nil
+}
+
+// The remainder of d / e, which has the sign of d
+func (d Decimal) Rem(e Decimal) (Decimal, error) {
+	a, b, scale := align(d, e)
+	if b.Sign() == 0 {
+		return Decimal{}, ErrDivisionByZero
+	}
+	return newDecimal(a.Rem(a, b), scale), nil
+}
+
+// d raised to the power n, by repeated squaring. The result is exact if it
+// has at most scale digits after the decimal point, otherwise it is rounded
+// to scale digits. Intermediate results keep a few more digits, so that
+// rounding them doesn't change the result. Returns ErrDecimalRange if an
+// intermediate result has more than MaxDecimalDigits digits.
+func (d Decimal) Pow(n uint, scale int, mode RoundingMode) (Decimal, error) {
+	guard := scale + len(strconv.FormatUint(uint64(n), 10)) + 2
+	step := func(x Decimal) (Decimal, error) {
+		if x.scale > guard {
+			x = x.Round(guard, mode)
+		}
+		return x, x.CheckRange()
+	}
+
+	res, sq := NewDecimal(1, 0), d
+	var err error
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			if res, err = step(res.Mul(sq)); err != nil {
+				return Decimal{}, err
+			}
+		}
+		if n > 1 {
+			if sq, err = step(sq.Mul(sq)); err != nil {
+				return Decimal{}, err
+			}
+		}
+	}
+
+	if res.scale > scale {
+		res = res.Round(scale, mode)
+	}
+	return res, nil
+}
+
+func (d Decimal) Neg() Decimal {
+	a := d.unscaled()
+	return newDecimal(a.Neg(a), d.scale)
+}
+
+// -1, 0 or +1 depending on the sign of d
+func (d Decimal) Sign() int {
+	return d.unscaled().Sign()
+}
+
+// Compare d and e, returning -1, 0 or +1. Trailing zeros don't matter, so
+// 1.50 and 1.5 are equal.
+func (d Decimal) Cmp(e Decimal) int {
+	a, b, _ := align(d, e)
+	return a.Cmp(b)
+}
+
+// The number of digits after the decimal point
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// Round d to scale digits after the decimal point. If d has fewer digits, it
+// is padded with zeros, so 1.5 rounded to 2 digits is 1.50.
+func (d Decimal) Round(scale int, mode RoundingMode) Decimal {
+	a := d.unscaled()
+	if scale >= d.scale {
+		return newDecimal(a.Mul(a, pow10(scale-d.scale)), scale)
+	}
+
+	den := pow10(d.scale - scale)
+	q, r := new(big.Int).QuoRem(a, den, new(big.Int))
+	return newDecimal(roundQuotient(q, r, den, mode), scale)
+}
+
+// Remove trailing zeros after the decimal point, keeping at least minScale
+// digits
+func (d Decimal) Trim(minScale int) Decimal {
+	coef, scale := strings.TrimLeft(d.coef, "-"), d.scale
+	for scale > minScale && strings.HasSuffix(coef, "0") {
+		coef, scale = coef[:len(coef)-1], scale-1
+		if coef == "" {
+			coef = "0"
+		}
+	}
+	if strings.HasPrefix(d.coef, "-") {
+		coef = "-" + coef
+	}
+	return Decimal{coef: coef, scale: scale}
+}
+
+// The decimal text of d, eg. "-10.50"
+func (d Decimal) text() string {
+	coef := d.coef
+	if coef == "" {
+		coef = "0"
+	}
+	if d.scale == 0 {
+		return coef
+	}
+
+	sign := ""
+	if strings.HasPrefix(coef, "-") {
+		sign, coef = "-", coef[1:]
+	}
+	if len(coef) <= d.scale {
+		coef = strings.Repeat("0", d.scale-len(coef)+1) + coef
+	}
+	return sign + coef[:len(coef)-d.scale] + "." + coef[len(coef)-d.scale:]
+}
+
+/////////////////////////////
+// Decimal
+
+func (d Decimal) DataType() string { return DataTypeDecimal }
+func (d Decimal) ToDecimal() (Decimal, error) {
+	return d, nil
+}
+func (d Decimal) ToString() (String, error) {
+	return String(d.text()), nil
+}
+func (d Decimal) ToPrint() string {
+	return d.text()
+}
+func (d Decimal) ToDouble() (Double, error) {
+	f, err := strconv.ParseFloat(d.text(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Cannot convert %s to Double: %v", d.text(), err)
+	}
+	return Double(f), nil
+}
+func (d Decimal) ToInt() (Int, error) {
+	i := d.Round(0, RoundDown).unscaled()
+	if !i.IsInt64() || i.Int64() > math.MaxInt || i.Int64() < math.MinInt {
+		return 0, fmt.Errorf("Cannot convert %s to Int: out of range", d.text())
+	}
+	return Int(i.Int64()), nil
+}
+func (d Decimal) ToBool() (Bool, error) {
+	return d.Sign() != 0, nil
+}
+
+// Conversions to Decimal from the other number types
+func (n Int) ToDecimal() (Decimal, error) {
+	return NewDecimal(int64(n), 0), nil
+}
+func (n Double) ToDecimal() (Decimal, error) {
+	if math.IsNaN(float64(n)) || math.IsInf(float64(n), 0) {
+		return Decimal{}, fmt.Errorf("Cannot convert %v to Decimal", float64(n))
+	}
+	// The shortest text that gives back the same Double, so 0.1 becomes 0.1
+	// and not 0.1000000000000000055511151231257827
+	return ParseDecimal(strconv.FormatFloat(float64(n), 'f', -1, 64))
+}
+func (s String) ToDecimal() (Decimal, error) {
+	return ParseDecimal(strings.TrimSpace(string(s)))
+}
@@ -0,0 +1,46 @@
+package datatype
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseDecimalRange(t *testing.T) {
+	for _, s := range []string{"1e100000000", "1e1000", "1e-100000000", "-9e-9223372036854775808", "0.5e-1000"} {
+		if d, err := ParseDecimal(s); !errors.Is(err, ErrDecimalRange) {
+			t.Errorf("ParseDecimal(%q) = %v, %v, want ErrDecimalRange", s, d.ToPrint(), err)
+		}
+	}
+	for _, s := range []string{"1e999", "1e-1000", "-12.5e3"} {
+		if _, err := ParseDecimal(s); err != nil {
+			t.Errorf("ParseDecimal(%q): %v", s, err)
+		}
+	}
+}
+
+func TestDecimalPow(t *testing.T) {
+	tests := []struct {
+		d     string
+		n     uint
+		scale int
+		want  string
+	}{
+		{"1.05", 2, 16, "1.1025"},
+		{"2", 10, 0, "1024"},
+		{"-1.5", 3, 16, "-3.375"},
+		{"7", 0, 16, "1"},
+		{"1.0001", 10000, 16, "2.7181459268252249"},
+		{"0.5", 100, 16, "0.0000000000000000"},
+	}
+	for _, tt := range tests {
+		d, _ := ParseDecimal(tt.d)
+		res, err := d.Pow(tt.n, tt.scale, RoundHalfEven)
+		if err != nil || res.ToPrint() != tt.want {
+			t.Errorf("%s^%d = %s, %v, want %s", tt.d, tt.n, res.ToPrint(), err, tt.want)
+		}
+	}
+
+	if _, err := NewDecimal(105, 2).Pow(2000000, 16, RoundHalfEven); !errors.Is(err, ErrDecimalRange) {
+		t.Errorf("1.05^2000000: got %v, want ErrDecimalRange", err)
+	}
+}
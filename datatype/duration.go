@@ -0,0 +1,240 @@
+package datatype
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DataTypeDuration = "Duration"
+
+// A length of time, written as 2h30m or in the ISO 8601 form PT2H30M
+type Duration time.Duration
+
+// The units of a duration like 1d2h30m, longest first
+var durationUnits = []struct {
+	name string
+	unit time.Duration
+}{
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+}
+
+// Parse a duration. It is either a sequence of numbers with units, eg. 2h30m
+// or 1.5d, or an ISO 8601 duration like P1DT2H. The units are d, h, m, s and
+// ms. Years and months aren't supported because their length varies.
+func ParseDuration(s string) (Duration, error) {
+	sign, text := time.Duration(1), s
+	if strings.HasPrefix(text, "-") {
+		sign, text = -1, text[1:]
+	}
+
+	var d time.Duration
+	var err error
+	if strings.HasPrefix(text, "P") {
+		d, err = parseISODuration(text)
+	} else {
+		d, err = parseUnitDuration(text)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Cannot convert '%s' to Duration: %v", s, err)
+	}
+	return Duration(sign * d), nil
+}
+
+func parseUnitDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("no value")
+	}
+
+	var total time.Duration
+	for s != "" {
+		n := 0
+		for n < len(s) && (s[n] >= '0' && s[n] <= '9' || s[n] == '.' || s[n] == '_') {
+			n++
+		}
+		num := s[:n]
+		s = s[n:]
+
+		u := 0
+		for u < len(s) && s[u] >= 'a' && s[u] <= 'z' {
+			u++
+		}
+		unit, ok := durationUnit(s[:u])
+		if num == "" || !ok {
+			return 0, fmt.Errorf("expected a number followed by one of the units d, h, m, s or ms")
+		}
+		s = s[u:]
+
+		d, err := scaleDuration(strings.Replace(num, "_", "", -1), unit)
+		if err != nil {
+			return 0, err
+		}
+		if total > math.MaxInt64-d {
+			return 0, fmt.Errorf("out of range")
+		}
+		total += d
+	}
+	return total, nil
+}
+
+func durationUnit(name string) (time.Duration, bool) {
+	for _, u := range durationUnits {
+		if u.name == name {
+			return u.unit, true
+		}
+	}
+	return 0, false
+}
+
+// The ISO 8601 designators, before and after the T
+var isoDateUnits = map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+var isoTimeUnits = map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+
+func parseISODuration(s string) (time.Duration, error) {
+	units, inTime := isoDateUnits, false
+	var total time.Duration
+	parts := 0
+
+	for s = s[1:]; s != ""; {
+		if s[0] == 'T' {
+			if inTime {
+				return 0, fmt.Errorf("more than one T")
+			}
+			units, inTime, s = isoTimeUnits, true, s[1:]
+			continue
+		}
+
+		n := 0
+		for n < len(s) && (s[n] >= '0' && s[n] <= '9' || s[n] == '.' || s[n] == ',') {
+			n++
+		}
+		if n == 0 || n == len(s) {
+			return 0, fmt.Errorf("expected a number followed by a designator")
+		}
+
+		unit, ok := units[s[n]]
+		if !ok {
+			if s[n] == 'Y' || s[n] == 'M' {
+				return 0, fmt.Errorf("years and months are not supported")
+			}
+			return 0, fmt.Errorf("unexpected designator %c", s[n])
+		}
+
+		d, err := scaleDuration(strings.Replace(s[:n], ",", ".", 1), unit)
+		if err != nil {
+			return 0, err
+		}
+		if total > math.MaxInt64-d {
+			return 0, fmt.Errorf("out of range")
+		}
+		total += d
+		parts++
+		s = s[n+1:]
+	}
+
+	if parts == 0 {
+		return 0, fmt.Errorf("no value")
+	}
+	return total, nil
+}
+
+// num units, where num may have a fraction
+func scaleDuration(num string, unit time.Duration) (time.Duration, error) {
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", num)
+	}
+	d := f * float64(unit)
+	if d >= math.MaxInt64 {
+		return 0, fmt.Errorf("out of range")
+	}
+	return time.Duration(math.Round(d)), nil
+}
+
+// The text of d in the form 1d2h30m15.5s
+func (d Duration) text() string {
+	if d == 0 {
+		return "0s"
+	}
+
+	var sb strings.Builder
+	v := time.Duration(d)
+	if v < 0 {
+		sb.WriteByte('-')
+	}
+
+	// Work with the magnitude as a uint64, so that the smallest Duration
+	// can be negated
+	rem := uint64(v)
+	if v < 0 {
+		rem = -rem
+	}
+	// Whole days, hours and minutes, and then seconds with a fraction
+	for _, u := range durationUnits {
+		if u.unit < time.Minute {
+			continue
+		}
+		if n := rem / uint64(u.unit); n > 0 {
+			sb.WriteString(strconv.FormatUint(n, 10) + u.name)
+			rem -= n * uint64(u.unit)
+		}
+	}
+	if rem > 0 {
+		sb.WriteString(strconv.FormatFloat(float64(rem)/float64(time.Second), 'f', -1, 64) + "s")
+	}
+	return sb.String()
+}
+
+/////////////////////////////
+// Duration
+
+func (d Duration) DataType() string { return DataTypeDuration }
+func (d Duration) ToDuration() (Duration, error) {
+	return d, nil
+}
+func (d Duration) ToString() (String, error) {
+	return String(d.text()), nil
+}
+func (d Duration) ToPrint() string {
+	return d.text()
+}
+
+// The components of the duration, eg. Hours is 2 for 1d2h30m, and its total
+// length in a unit, eg. TotalHours is 26.5 for 1d2h30m. The components have
+// the sign of the duration.
+func (d Duration) Member(name string) (DataType, bool, error) {
+	v := time.Duration(d)
+	switch name {
+	case "Days":
+		return Int(v / (24 * time.Hour)), true, nil
+	case "Hours":
+		return Int(v % (24 * time.Hour) / time.Hour), true, nil
+	case "Minutes":
+		return Int(v % time.Hour / time.Minute), true, nil
+	case "Seconds":
+		return Int(v % time.Minute / time.Second), true, nil
+	case "Milliseconds":
+		return Int(v % time.Second / time.Millisecond), true, nil
+	case "TotalDays":
+		return Double(v.Hours() / 24), true, nil
+	case "TotalHours":
+		return Double(v.Hours()), true, nil
+	case "TotalMinutes":
+		return Double(v.Minutes()), true, nil
+	case "TotalSeconds":
+		return Double(v.Seconds()), true, nil
+	case "TotalMilliseconds":
+		return Double(float64(v) / float64(time.Millisecond)), true, nil
+	}
+	return nil, false, nil
+}
+
+func (s String) ToDuration() (Duration, error) {
+	return ParseDuration(strings.TrimSpace(string(s)))
+}
@@ -3,24 +3,44 @@ package datatype
 import "fmt"
 
 // A list of values. The type of the list is determined by the type of the
-// first element in the list.
+// first element in the list that isn't null.
 type List []DataType
 
 func (l List) DataType() string {
+	for _, item := range l {
+		if !IsNull(item) {
+			return fmt.Sprintf("%s[]", item.DataType())
+		}
+	}
 	if len(l) > 0 {
-		return fmt.Sprintf("%s[]", l[0].DataType())
+		return fmt.Sprintf("%s[]", DataTypeNull)
 	} else {
 		return "Unknown[]"
 	}
 }
 
+// The items of the list that aren't null
+func (l List) WithoutNulls() List {
+	nl := List{}
+	for _, item := range l {
+		if !IsNull(item) {
+			nl = append(nl, item)
+		}
+	}
+	return nl
+}
+
 type converter func(DataType) (DataType, error)
 
 // convert all elements of a list to a particular type using the convert
-// function
+// function. Null elements are kept as they are.
 func (l List) convertDataType(convert converter) (List, error) {
 	nl := List{}
 	for _, item := range l {
+		if IsNull(item) {
+			nl = append(nl, item)
+			continue
+		}
 		v, err := convert(item)
 		if err != nil {
 			return nil, err
@@ -42,6 +62,10 @@ func (l List) AllToDouble() (List, error) {
 	return l.convertDataType(func(v DataType) (DataType, error) { cv, err := ToDouble(v); return cv, err })
 }
 
+func (l List) AllToDecimal() (List, error) {
+	return l.convertDataType(func(v DataType) (DataType, error) { cv, err := ToDecimal(v); return cv, err })
+}
+
 func (l List) AllToString() (List, error) {
 	return l.convertDataType(func(v DataType) (DataType, error) { cv, err := ToString(v); return cv, err })
 }
@@ -50,6 +74,10 @@ func (l List) AllToChar() (List, error) {
 	return l.convertDataType(func(v DataType) (DataType, error) { cv, err := ToChar(v); return cv, err })
 }
 
+func (l List) AllToDateTime() (List, error) {
+	return l.convertDataType(func(v DataType) (DataType, error) { cv, err := ToDateTime(v); return cv, err })
+}
+
 func (l List) ToString() (String, error) {
 	res := ""
 	for i, item := range l {
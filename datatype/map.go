@@ -0,0 +1,52 @@
+package datatype
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const DataTypeMap = "Map"
+
+// A record of values with string keys, written as @{"a": 1, "b": [2, 3]}.
+// Keys that are not in the map have the value null.
+type Map map[string]DataType
+
+func (m Map) DataType() string { return DataTypeMap }
+
+// Member reports a key that isn't in the map as not found. Use Get for the
+// null value of a missing key.
+func (m Map) Member(name string) (DataType, bool, error) {
+	v, ok := m[name]
+	return v, ok, nil
+}
+
+// The value for key, or null if the map doesn't have the key
+func (m Map) Get(key string) DataType {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	return Null{}
+}
+
+// The keys of the map in sorted order
+func (m Map) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m Map) ToPrint() string {
+	parts := make([]string, 0, len(m))
+	for _, k := range m.Keys() {
+		parts = append(parts, fmt.Sprintf("%q: %s", k, ToPrint(m[k])))
+	}
+	return "@{" + strings.Join(parts, ", ") + "}"
+}
+
+func (m Map) ToString() (String, error) {
+	return String(m.ToPrint()), nil
+}
@@ -0,0 +1,207 @@
+package datatype
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const DataTypeObject = "Object"
+
+// Data types that have named members implement this interface so that the
+// members can be accessed with value.Name. Member returns false if there is no
+// member with that name.
+type MemberAccessor interface {
+	Member(name string) (DataType, bool, error)
+}
+
+// A Go struct. Fields are converted to data types only when they are
+// accessed.
+//
+// Struct fields are accessed by their name unless the field has an `expr` tag:
+// `expr:"name"` renames the field and `expr:"-"` hides it. Options after a
+// comma are ignored, so `expr:",omitempty"` keeps the Go name. Unexported
+// fields are never visible.
+type Object struct {
+	v reflect.Value
+}
+
+func (o Object) DataType() string { return DataTypeObject }
+
+func (o Object) Member(name string) (DataType, bool, error) {
+	f, ok := structField(o.v, name)
+	if !ok {
+		return nil, false, nil
+	}
+	d, err := fromValue(f)
+	return d, true, err
+}
+
+func (o Object) ToPrint() string {
+	return fmt.Sprintf("%+v", o.v.Interface())
+}
+
+// Find the visible field of a struct with the given name, including fields
+// promoted from embedded structs. As in Go, a field hides the fields with the
+// same name that are embedded deeper, and a name that matches more than one
+// field at the same depth is ambiguous and matches none of them.
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	for level := []reflect.Value{v}; len(level) > 0; {
+		var matches, embedded []reflect.Value
+		for _, sv := range level {
+			t := sv.Type()
+			for i := 0; i < t.NumField(); i++ {
+				sf := t.Field(i)
+				tag := sf.Tag.Get("expr")
+				if tag == "-" {
+					continue
+				}
+				tagName := strings.Split(tag, ",")[0]
+
+				if sf.Anonymous && tagName == "" {
+					if fv := indirect(sv.Field(i)); fv.Kind() == reflect.Struct {
+						embedded = append(embedded, fv)
+					}
+					continue
+				}
+
+				if sf.PkgPath != "" { // unexported
+					continue
+				}
+
+				fieldName := sf.Name
+				if tagName != "" {
+					fieldName = tagName
+				}
+				if fieldName == name {
+					matches = append(matches, sv.Field(i))
+				}
+			}
+		}
+
+		if len(matches) > 0 {
+			return matches[0], len(matches) == 1
+		}
+		level = embedded
+	}
+	return reflect.Value{}, false
+}
+
+// GoMember returns the member name of the Go value v without converting v to
+// a data type, so a large map isn't copied to look up one key. v is a struct
+// or a map with string keys, or a pointer to one. The members are those of the
+// data type FromValue converts v to, and a key that isn't in a map is nil. ok
+// is false if v is a DataType, some other Go value, or a struct without the
+// member.
+func GoMember(v interface{}, name string) (interface{}, bool) {
+	if _, ok := v.(DataType); ok {
+		return nil, false
+	}
+
+	rv := indirect(reflect.ValueOf(v))
+	switch {
+	case rv.Kind() == reflect.Struct && rv.Type() != timeType:
+		f, ok := structField(rv, name)
+		if !ok || !f.CanInterface() {
+			return nil, false
+		}
+		return f.Interface(), true
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		item := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !item.IsValid() {
+			return nil, true
+		}
+		return item.Interface(), true
+	}
+	return nil, false
+}
+
+// Follow pointers and interfaces to the underlying value
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// FromValue converts a Go value to the matching data type. Integers become
+// Int, floats Double, strings String, bools Bool, time.Time DateTime,
+// time.Duration Duration, slices and arrays a List and maps with string keys
+// a Map. Structs become an Object. Nil pointers and interfaces become Null.
+// Values that already are a DataType are returned unchanged.
+func FromValue(v interface{}) (DataType, error) {
+	if d, ok := v.(DataType); ok {
+		return d, nil
+	}
+	return fromValue(reflect.ValueOf(v))
+}
+
+func fromValue(v reflect.Value) (DataType, error) {
+	if v.IsValid() && v.CanInterface() {
+		if d, ok := v.Interface().(DataType); ok {
+			return d, nil
+		}
+	}
+
+	v = indirect(v)
+	if !v.IsValid() {
+		return Null{}, nil
+	}
+
+	if v.Type() == timeType {
+		return DateTime(v.Interface().(time.Time)), nil
+	}
+	if v.Type() == durationType {
+		return Duration(v.Int()), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return Bool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Int(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt {
+			return nil, fmt.Errorf("Cannot convert %d to Int: out of range", v.Uint())
+		}
+		return Int(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return Double(v.Float()), nil
+	case reflect.String:
+		return String(v.String()), nil
+	case reflect.Slice, reflect.Array:
+		l := make(List, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := fromValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, item)
+		}
+		return l, nil
+	case reflect.Struct:
+		return Object{v}, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			m := make(Map, v.Len())
+			for iter := v.MapRange(); iter.Next(); {
+				item, err := fromValue(iter.Value())
+				if err != nil {
+					return nil, err
+				}
+				m[iter.Key().String()] = item
+			}
+			return m, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Cannot convert Go type %s to a data type", v.Type())
+}
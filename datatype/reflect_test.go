@@ -0,0 +1,102 @@
+package datatype
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFromValueUintRange(t *testing.T) {
+	if v, err := FromValue(uint64(1<<63 - 1)); err != nil || v != Int(1<<63-1) {
+		t.Errorf("FromValue(MaxInt64) = %v, %v", v, err)
+	}
+	if v, err := FromValue(uint64(1 << 63)); err == nil {
+		t.Errorf("FromValue(1<<63) = %v, want an out of range error", v)
+	}
+}
+
+func TestFromValueMap(t *testing.T) {
+	type Item struct{ Name string }
+	v, err := FromValue(map[string]interface{}{"n": 1, "items": []Item{{"a"}}, "tags": map[string]string{"x": "y"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := v.(Map)
+	if !ok {
+		t.Fatalf("FromValue(map) = %T, want Map", v)
+	}
+	if m["n"] != Int(1) || m["tags"].(Map)["x"] != String("y") {
+		t.Errorf("FromValue(map) = %s", m.ToPrint())
+	}
+	if _, ok := m["items"].(List)[0].(Object); !ok {
+		t.Errorf("struct item is %T, want Object", m["items"].(List)[0])
+	}
+}
+
+func TestStructFieldNames(t *testing.T) {
+	type Base struct {
+		ID   int
+		Name string
+	}
+	type Inner struct {
+		Base
+		Code string
+	}
+	type Outer struct {
+		Inner
+		Name   string `expr:",omitempty"`
+		Total  int    `expr:"total,omitempty"`
+		Hidden int    `expr:"-"`
+	}
+	o := Object{reflect.ValueOf(Outer{
+		Inner: Inner{Base: Base{ID: 7, Name: "base"}, Code: "c"},
+		Name:  "outer",
+		Total: 3,
+	})}
+
+	tests := map[string]DataType{
+		"Name":  String("outer"),
+		"ID":    Int(7),
+		"Code":  String("c"),
+		"total": Int(3),
+	}
+	for name, want := range tests {
+		if v, found, err := o.Member(name); err != nil || !found || v != want {
+			t.Errorf("Member(%s) = %v, %t, %v, want %v", name, v, found, err, want)
+		}
+	}
+	for _, name := range []string{"Total", "Hidden", "Base", "Inner", ""} {
+		if v, found, _ := o.Member(name); found {
+			t.Errorf("Member(%s) = %v, want not found", name, v)
+		}
+	}
+}
+
+func TestStructFieldAmbiguous(t *testing.T) {
+	type A struct{ X, Y int }
+	type B struct{ X int }
+	type C struct {
+		A
+		*B
+	}
+	o := Object{reflect.ValueOf(C{A{1, 2}, &B{3}})}
+
+	if v, found, _ := o.Member("X"); found {
+		t.Errorf("Member(X) = %v, want not found because A.X and B.X are at the same depth", v)
+	}
+	if v, found, err := o.Member("Y"); err != nil || !found || v != Int(2) {
+		t.Errorf("Member(Y) = %v, %t, %v, want 2", v, found, err)
+	}
+}
+
+func TestMapMemberMissing(t *testing.T) {
+	m := Map{"a": Int(1)}
+	if v, found, _ := m.Member("a"); !found || v != Int(1) {
+		t.Errorf("Member(a) = %v, %t, want 1", v, found)
+	}
+	if v, found, _ := m.Member("b"); found {
+		t.Errorf("Member(b) = %v, want not found", v)
+	}
+	if v := m.Get("b"); !IsNull(v) {
+		t.Errorf("Get(b) = %v, want null", v)
+	}
+}
@@ -11,6 +11,25 @@ func IsDateTime(vs ...DataType) bool {
 	return true
 }
 
+func IsDuration(vs ...DataType) bool {
+	for _, v := range vs {
+		if v.DataType() != DataTypeDuration {
+			return false
+		}
+	}
+	return true
+}
+
+// Check if any of the values is a DateTime or a Duration
+func IsTimeAny(vs ...DataType) bool {
+	for _, v := range vs {
+		if v.DataType() == DataTypeDateTime || v.DataType() == DataTypeDuration {
+			return true
+		}
+	}
+	return false
+}
+
 func IsInt(vs ...DataType) bool {
 	for _, v := range vs {
 		if v.DataType() != DataTypeInt {
@@ -22,13 +41,23 @@ func IsInt(vs ...DataType) bool {
 
 func IsNumber(vs ...DataType) bool {
 	for _, v := range vs {
-		if v.DataType() != DataTypeInt && v.DataType() != DataTypeDouble {
+		if v.DataType() != DataTypeInt && v.DataType() != DataTypeDouble && v.DataType() != DataTypeDecimal {
 			return false
 		}
 	}
 	return true
 }
 
+// Check if any of the values is a Decimal
+func IsDecimalAny(vs ...DataType) bool {
+	for _, v := range vs {
+		if v.DataType() == DataTypeDecimal {
+			return true
+		}
+	}
+	return false
+}
+
 func IsString(vs ...DataType) bool {
 	for _, v := range vs {
 		if v.DataType() != DataTypeString {
@@ -47,6 +76,34 @@ func IsBool(vs ...DataType) bool {
 	return true
 }
 
+func IsNull(vs ...DataType) bool {
+	for _, v := range vs {
+		if v.DataType() != DataTypeNull {
+			return false
+		}
+	}
+	return true
+}
+
+// Check if any of the values is null
+func IsNullAny(vs ...DataType) bool {
+	for _, v := range vs {
+		if v.DataType() == DataTypeNull {
+			return true
+		}
+	}
+	return false
+}
+
+func IsMap(vs ...DataType) bool {
+	for _, v := range vs {
+		if _, isMap := v.(Map); !isMap {
+			return false
+		}
+	}
+	return true
+}
+
 func IsListAny(vs ...DataType) bool {
 	res := false
 	for _, v := range vs {
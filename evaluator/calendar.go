@@ -0,0 +1,102 @@
+package evaluator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/contactkeval/expressioneval/datatype"
+)
+
+// A business day calendar. A day is a business day if it is neither a
+// weekend day nor a holiday. Set up calendars before evaluating any
+// expressions that use them.
+type Calendar struct {
+	weekend  [7]bool
+	holidays map[civilDate]string
+}
+
+// A holiday of a calendar. Only the date of Date is used.
+type Holiday struct {
+	Date time.Time
+	Name string
+}
+
+// A day without a time of day or time zone
+type civilDate struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+func dateOf(t time.Time) civilDate {
+	y, m, d := t.Date()
+	return civilDate{y, m, d}
+}
+
+// NewCalendar creates a calendar without holidays. Saturday and Sunday are
+// the weekend if weekend is nil. Pass an empty slice for a calendar without a
+// weekend.
+func NewCalendar(weekend []time.Weekday) *Calendar {
+	if weekend == nil {
+		weekend = []time.Weekday{time.Saturday, time.Sunday}
+	}
+	c := &Calendar{holidays: map[civilDate]string{}}
+	for _, wd := range weekend {
+		c.weekend[wd] = true
+	}
+	return c
+}
+
+// AddHolidays adds holidays to the calendar. A holiday replaces one with the
+// same date.
+func (c *Calendar) AddHolidays(holidays ...Holiday) {
+	for _, h := range holidays {
+		c.holidays[dateOf(h.Date)] = h.Name
+	}
+}
+
+// The name of the holiday on the date of t, and if there is one
+func (c *Calendar) Holiday(t time.Time) (string, bool) {
+	name, ok := c.holidays[dateOf(t)]
+	return name, ok
+}
+
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	if c.weekend[t.Weekday()] {
+		return false
+	}
+	_, holiday := c.Holiday(t)
+	return !holiday
+}
+
+// Used when the environment has no calendar
+var weekdayCalendar = NewCalendar(nil)
+
+// The calendar with the given name, or the default calendar of the
+// environment if name is empty
+func (env *Env) calendar(name string) (*Calendar, error) {
+	if name == "" {
+		if env.Calendar != nil {
+			return env.Calendar, nil
+		}
+		return weekdayCalendar, nil
+	}
+	if c, ok := env.Calendars[name]; ok && c != nil {
+		return c, nil
+	}
+	return nil, fmt.Errorf("Unknown calendar '%s'", name)
+}
+
+// The calendar named by the argument after the first n, or the default
+// calendar if there is no such argument
+func calendarArg(env *Env, args []datatype.DataType, n int) (*Calendar, error) {
+	name := ""
+	if len(args) > n {
+		name = toString(args[n])
+	}
+	c, err := env.calendar(name)
+	if err != nil {
+		return nil, &ArgumentError{Args: args, Msg: err.Error()}
+	}
+	return c, nil
+}
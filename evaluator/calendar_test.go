@@ -0,0 +1,193 @@
+package evaluator
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// An environment in UTC whose calendar has Christmas, Boxing Day and New
+// Year's Day 2025 as holidays, and a calendar "none" without a weekend or
+// holidays
+func calendarEnv() *Env {
+	cal := NewCalendar(nil)
+	cal.AddHolidays(
+		Holiday{Date: date(2024, 12, 25), Name: "Christmas Day"},
+		Holiday{Date: date(2024, 12, 26), Name: "Boxing Day"},
+		Holiday{Date: date(2025, 1, 1), Name: "New Year's Day"},
+	)
+	env := NewEnv(GlobalSymbols)
+	env.Location = time.UTC
+	env.Calendar = cal
+	env.Calendars = map[string]*Calendar{"none": NewCalendar([]time.Weekday{})}
+	return env
+}
+
+func TestBusinessDays(t *testing.T) {
+	env := calendarEnv()
+	tests := map[string]string{
+		// 2024-12-24 is a Tuesday and 2024-12-28 a Saturday
+		`AddBusinessDays(<H>"2024-12-24", 1)`:          "2024-12-27T00:00:00Z",
+		`AddBusinessDays(<H>"2024-12-27", 1)`:          "2024-12-30T00:00:00Z",
+		`AddBusinessDays(<H>"2024-12-27", 3)`:          "2025-01-02T00:00:00Z",
+		`AddBusinessDays(<H>"2024-12-30", -1)`:         "2024-12-27T00:00:00Z",
+		`AddBusinessDays(<H>"2024-12-27", -1)`:         "2024-12-24T00:00:00Z",
+		`AddBusinessDays(<H>"2025-01-02", -4)`:         "2024-12-24T00:00:00Z",
+		`AddBusinessDays(<H>"2024-12-28", 0)`:          "2024-12-28T00:00:00Z",
+		`AddBusinessDays(<H>"2024-12-28", -1)`:         "2024-12-27T00:00:00Z",
+		`AddBusinessDays(<H>"2024-12-28", 1)`:          "2024-12-30T00:00:00Z",
+		`AddBusinessDays(<H>"2024-12-24", 1, "none")`:  "2024-12-25T00:00:00Z",
+		`AddBusinessDays(<H>"2024-12-24", -3, "none")`: "2024-12-21T00:00:00Z",
+
+		`BusinessDaysBetween(<H>"2024-12-24", <H>"2025-01-02")`:         "4",
+		`BusinessDaysBetween(<H>"2025-01-02", <H>"2024-12-24")`:         "-4",
+		`BusinessDaysBetween(<H>"2024-12-24", <H>"2024-12-24")`:         "0",
+		`BusinessDaysBetween(<H>"2024-12-24", <H>"2024-12-26")`:         "0",
+		`BusinessDaysBetween(<H>"2024-12-24", <H>"2025-01-02", "none")`: "9",
+
+		`IsBusinessDay(<H>"2024-12-24")`:         "true",
+		`IsBusinessDay(<H>"2024-12-25")`:         "false",
+		`IsBusinessDay(<H>"2024-12-28")`:         "false",
+		`IsBusinessDay(<H>"2024-12-25", "none")`: "true",
+
+		`NextBusinessDay(<H>"2024-12-24")`:         "2024-12-27T00:00:00Z",
+		`NextBusinessDay(<H>"2024-12-31")`:         "2025-01-02T00:00:00Z",
+		`NextBusinessDay(<H>"2024-12-24", "none")`: "2024-12-25T00:00:00Z",
+
+		`DateAdd(<H>"2024-12-24", 1, "businessday")`:                "2024-12-27T00:00:00Z",
+		`DateAdd(<H>"2024-12-27", -1, "businessdays")`:              "2024-12-24T00:00:00Z",
+		`DateDiff(<H>"2024-12-24", <H>"2025-01-02", "businessday")`: "4",
+	}
+	for text, want := range tests {
+		if got := evalPrintIn(env, text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+
+	p, err := Compile(`AddBusinessDays(<H>"2024-12-24", 1, "xx")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Eval(env); err == nil || !strings.Contains(err.Error(), "Unknown calendar 'xx'") {
+		t.Errorf("unknown calendar: error %v", err)
+	}
+}
+
+func TestWeekdayCalendarIsDefault(t *testing.T) {
+	env := NewEnv(GlobalSymbols)
+	env.Location = time.UTC
+	tests := map[string]string{
+		`AddBusinessDays(<H>"2024-12-24", 1)`: "2024-12-25T00:00:00Z",
+		`AddBusinessDays(<H>"2024-12-27", 1)`: "2024-12-30T00:00:00Z",
+		`IsBusinessDay(<H>"2024-12-29")`:      "false",
+	}
+	for text, want := range tests {
+		if got := evalPrintIn(env, text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestReadHolidaysICS(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20241225",
+		"DTEND;VALUE=DATE:20241227",
+		"SUMMARY:Christmas\\, Boxing",
+		"  Day",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:New Year's Day",
+		"DTSTART:20250101T000000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	holidays, err := ReadHolidaysICS(strings.NewReader(ics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Holiday{
+		{Date: date(2024, 12, 25), Name: "Christmas, Boxing Day"},
+		{Date: date(2024, 12, 26), Name: "Christmas, Boxing Day"},
+		{Date: date(2025, 1, 1), Name: "New Year's Day"},
+	}
+	if len(holidays) != len(want) {
+		t.Fatalf("read %v, want %v", holidays, want)
+	}
+	for i, h := range holidays {
+		if !h.Date.Equal(want[i].Date) || h.Name != want[i].Name {
+			t.Errorf("holiday %d = %v, want %v", i, h, want[i])
+		}
+	}
+}
+
+func TestReadHolidaysICSErrors(t *testing.T) {
+	tests := map[string]string{
+		"BEGIN:VEVENT\nDTSTART:2024122\nEND:VEVENT":                     "Line 2: invalid date '2024122'",
+		"BEGIN:VEVENT\nDTSTART:20241332\nEND:VEVENT":                    "Line 2: invalid date '20241332'",
+		"BEGIN:VEVENT\nSUMMARY:No date\n\nEND:VEVENT":                   "Line 4: event without a DTSTART",
+		"BEGIN:VEVENT\nDTSTART:20241225":                                "Event without an END:VEVENT",
+		"BEGIN:VEVENT\nDTSTART:20241225\nRRULE:FREQ=YEARLY\nEND:VEVENT": "Line 3: recurring events are not supported",
+		"BEGIN:VEVENT\nDTSTART:20240101\nDTEND:20260101\nEND:VEVENT":    "Line 4: event is longer than 366 days",
+	}
+	for ics, want := range tests {
+		if _, err := ReadHolidaysICS(strings.NewReader(ics)); err == nil || err.Error() != want {
+			t.Errorf("%q: error %v, want %s", ics, err, want)
+		}
+	}
+}
+
+func TestReadHolidaysCSV(t *testing.T) {
+	csv := "Date,Name\n" +
+		"# Public holidays\n" +
+		"2024-12-25, Christmas Day\n" +
+		"\n" +
+		"2024-12-26\n" +
+		"2025-01-01,New Year's Day,extra\n"
+
+	holidays, err := ReadHolidaysCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Holiday{
+		{Date: date(2024, 12, 25), Name: "Christmas Day"},
+		{Date: date(2024, 12, 26)},
+		{Date: date(2025, 1, 1), Name: "New Year's Day"},
+	}
+	if len(holidays) != len(want) {
+		t.Fatalf("read %v, want %v", holidays, want)
+	}
+	for i, h := range holidays {
+		if !h.Date.Equal(want[i].Date) || h.Name != want[i].Name {
+			t.Errorf("holiday %d = %v, want %v", i, h, want[i])
+		}
+	}
+
+	// Without a header the first record is a holiday too
+	holidays, err = ReadHolidaysCSV(strings.NewReader("2024-12-25\n2024-12-26\n"))
+	if err != nil || len(holidays) != 2 {
+		t.Errorf("without a header read %v, %v, want 2 holidays", holidays, err)
+	}
+}
+
+func TestReadHolidaysCSVErrors(t *testing.T) {
+	tests := []string{
+		"Date,Name\n2024-12-25,Christmas\nDecember 26,Boxing Day\n",
+		"2024-12-25\n2024-13-01\n",
+		"2024-12-25,\"Christmas\n",
+	}
+	wantLine := []string{"Line 3:", "Line 2:", "line 1"}
+	for i, csv := range tests {
+		if _, err := ReadHolidaysCSV(strings.NewReader(csv)); err == nil || !strings.Contains(err.Error(), wantLine[i]) {
+			t.Errorf("%q: error %v, want one at %s", csv, err, wantLine[i])
+		}
+	}
+}
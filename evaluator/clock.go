@@ -0,0 +1,35 @@
+package evaluator
+
+import "time"
+
+// A Clock supplies the current time to the symbols and intrinsic methods that
+// depend on it, eg. DateTime.Today
+type Clock interface {
+	Now() time.Time
+}
+
+// The clock of the system. Environments use it if they don't have a clock.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// A clock that is stopped at a fixed time, eg. for tests
+type FixedClock time.Time
+
+func (c FixedClock) Now() time.Time { return time.Time(c) }
+
+// A clock that reads the time from another clock once and then keeps
+// returning that time. Each evaluation uses one, so that every reference to
+// the current time in an expression sees the same time.
+type onceClock struct {
+	clock Clock
+	now   time.Time
+	read  bool
+}
+
+func (c *onceClock) Now() time.Time {
+	if !c.read {
+		c.now, c.read = c.clock.Now(), true
+	}
+	return c.now
+}
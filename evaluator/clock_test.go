@@ -0,0 +1,94 @@
+package evaluator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/contactkeval/expressioneval/datatype"
+)
+
+// A clock that moves on by a day every time it is read
+type tickingClock struct {
+	now   time.Time
+	reads int
+}
+
+func (c *tickingClock) Now() time.Time {
+	c.reads++
+	c.now = c.now.AddDate(0, 0, 1)
+	return c.now
+}
+
+func TestFixedClock(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	now := time.Date(2024, 3, 15, 23, 30, 0, 0, time.UTC)
+	env := NewEnv(GlobalSymbols)
+	env.Clock = FixedClock(now)
+
+	if got := env.Now(); !got.Equal(now) {
+		t.Errorf("Now() = %v, want %v", got, now)
+	}
+
+	env.Location = tokyo
+	if got, want := env.Today(), datatype.DateTime(time.Date(2024, 3, 16, 0, 0, 0, 0, tokyo)); !time.Time(got).Equal(time.Time(want)) || time.Time(got).Location() != tokyo {
+		t.Errorf("Today() = %s, want %s", got.ToPrint(), want.ToPrint())
+	}
+
+	tests := map[string]string{
+		"DateTime.Today":      "2024-03-16T00:00:00+09:00",
+		"DateTime.Today.Year": "2024",
+		"DateTime.Today.Day":  "16",
+	}
+	for text, want := range tests {
+		if got := evalPrintIn(env, text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestSystemClock(t *testing.T) {
+	before := time.Now()
+	now := NewEnv(nil).Now()
+	if now.Before(before) || now.After(time.Now()) {
+		t.Errorf("Now() = %v, want the time of the system clock", now)
+	}
+}
+
+// The clock is read once per evaluation, so every reference to the current
+// time in an expression sees the same time
+func TestClockIsReadOncePerEvaluation(t *testing.T) {
+	clock := &tickingClock{now: time.Date(2024, 3, 15, 23, 59, 59, 0, time.UTC)}
+	env := NewEnv(GlobalSymbols)
+	env.Clock = clock
+	env.Location = time.UTC
+
+	p, err := Compile("DateTime.Today = DateTime.Today && DateAdd(DateTime.Today, 1, \"day\") > DateTime.Today")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		v, err := p.Eval(env)
+		if err != nil || v != datatype.Bool(true) {
+			t.Errorf("Eval = %v, %v, want true", v, err)
+		}
+		if clock.reads != i {
+			t.Errorf("clock read %d times in %d evaluations", clock.reads, i)
+		}
+	}
+
+	if got := evalPrintIn(env, "1 + 1"); got != "2" || clock.reads != 2 {
+		t.Errorf("1 + 1 = %s and read the clock, want 2 without reading it", got)
+	}
+}
+
+// A resolver can supply its own DateTime.Today
+func TestTodayCanBeShadowed(t *testing.T) {
+	env := NewEnv(MapResolver{"DateTime.Today": datatype.String("today")})
+	env.Clock = FixedClock(time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC))
+	if got := evalPrintIn(env, "DateTime.Today"); got != "today" {
+		t.Errorf("DateTime.Today = %s, want today", got)
+	}
+}
@@ -0,0 +1,121 @@
+package evaluator
+
+import (
+	"strings"
+	"time"
+
+	"github.com/contactkeval/expressioneval/datatype"
+)
+
+// The environment an expression is evaluated in. Each evaluation can be given
+// its own environment, so the same expression can be evaluated for different
+// data at the same time.
+type Env struct {
+	// Supplies the values of the symbols referenced by the expression. No
+	// symbols can be resolved if this is nil.
+	Symbols Resolver
+
+	// The intrinsic methods the expression can call. DefaultFunctions is used
+	// if this is nil.
+	Functions *FunctionSet
+
+	// The layouts, in the syntax of the time package, that are accepted when
+	// a String is cast to a DateTime. They are tried in order.
+	// datatype.DefaultDateTimeLayouts is used if this is nil.
+	DateTimeLayouts []string
+
+	// The time zone of DateTimes parsed from text that has no offset, and of
+	// the current time. time.Local is used if this is nil.
+	Location *time.Location
+
+	// The source of the current time. SystemClock is used if this is nil.
+	Clock Clock
+
+	// The scale and rounding of Decimal division, and the rounding of methods
+	// like Round that aren't given one. datatype.DefaultDecimalContext() is
+	// used if this is nil.
+	DecimalContext *datatype.DecimalContext
+
+	// The business day calendars that methods like AddBusinessDays can be
+	// given by name
+	Calendars map[string]*Calendar
+
+	// The calendar used when a method isn't given the name of one, and for
+	// the businessday unit of DateAdd and DateDiff. If this is nil, Monday to
+	// Friday are the business days and there are no holidays.
+	Calendar *Calendar
+}
+
+// NewEnv creates an environment that resolves symbols using r
+func NewEnv(r Resolver) *Env {
+	return &Env{Symbols: r}
+}
+
+// The function set to use for method calls
+func (env *Env) functions() *FunctionSet {
+	if env.Functions != nil {
+		return env.Functions
+	}
+	return DefaultFunctions
+}
+
+// ParseDateTime converts text to a DateTime using the layouts and time zone of
+// the environment
+func (env *Env) ParseDateTime(s string) (datatype.DateTime, error) {
+	layouts := env.DateTimeLayouts
+	if layouts == nil {
+		layouts = datatype.DefaultDateTimeLayouts
+	}
+	return datatype.ParseDateTime(s, layouts, env.location())
+}
+
+func (env *Env) location() *time.Location {
+	if env.Location != nil {
+		return env.Location
+	}
+	return time.Local
+}
+
+func (env *Env) clock() Clock {
+	if env.Clock != nil {
+		return env.Clock
+	}
+	return SystemClock{}
+}
+
+func (env *Env) decimalContext() datatype.DecimalContext {
+	if env.DecimalContext != nil {
+		return *env.DecimalContext
+	}
+	return datatype.DefaultDecimalContext()
+}
+
+// Now returns the current time of the environment's clock in its time zone
+func (env *Env) Now() time.Time {
+	return env.clock().Now().In(env.location())
+}
+
+// Today returns midnight at the start of the current day
+func (env *Env) Today() datatype.DateTime {
+	now := env.Now()
+	y, m, d := now.Date()
+	return datatype.DateTime(time.Date(y, m, d, 0, 0, 0, 0, now.Location()))
+}
+
+// The resolver for the symbols of an expression. Symbols whose value depends
+// on the environment are only used if the environment's resolver doesn't know
+// the symbol.
+func (env *Env) symbols() Resolver {
+	return ChainResolver{env.Symbols, FuncResolver(env.resolveSymbol)}
+}
+
+func (env *Env) resolveSymbol(name string) (datatype.DataType, bool, error) {
+	if name != "DateTime.Today" && !strings.HasPrefix(name, "DateTime.Today.") {
+		return nil, false, nil
+	}
+	return MapResolver{"DateTime.Today": env.Today()}.Resolve(name)
+}
+
+// Used when no environment is passed in. Symbols are resolved from the global
+// SymbolTable.
+var defaultEnv = NewEnv(GlobalSymbols)
@@ -0,0 +1,280 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/contactkeval/expressioneval/datatype"
+	"github.com/contactkeval/expressioneval/tokenizer"
+)
+
+// Error codes. These are stable and can be used by callers to tell kinds of
+// errors apart.
+const (
+	ErrorCodeSyntax          = tokenizer.ErrorCodeSyntax
+	ErrorCodeUnknownSymbol   = "unknown_symbol"
+	ErrorCodeUnknownFunction = "unknown_function"
+	ErrorCodeTypeMismatch    = "type_mismatch"
+	ErrorCodeIndexOutOfRange = "index_out_of_range"
+	ErrorCodeArgument        = "argument_error"
+	ErrorCodeOverflow        = "overflow"
+	ErrorCodeDivisionByZero  = "division_by_zero"
+	ErrorCodeRuntime         = "runtime_error"
+)
+
+// Implemented by all errors returned when compiling or evaluating an
+// expression. Use errors.As to get the concrete error type.
+type Error interface {
+	error
+	Code() string
+	ErrorSpan() tokenizer.Span // The part of the expression that failed
+}
+
+// A syntax error found by the tokenizer or parser
+type SyntaxError = tokenizer.SyntaxError
+
+// A symbol, or a member of a value, that does not exist
+type UnknownSymbolError struct {
+	Span   tokenizer.Span
+	Name   string
+	Target string // Data type of the value whose member was accessed, if any
+}
+
+func (e *UnknownSymbolError) Error() string {
+	if e.Target != "" {
+		return errorAt(fmt.Sprintf("%s has no member %s", e.Target, e.Name), e.Span)
+	}
+	return errorAt(fmt.Sprintf("Could not find symbol %s (name does not exist)", e.Name), e.Span)
+}
+
+// A call to an intrinsic method that does not exist
+type UnknownFunctionError struct {
+	Span tokenizer.Span
+	Name string
+}
+
+func (e *UnknownFunctionError) Error() string {
+	return errorAt(fmt.Sprintf("Method %s does not exist", e.Name), e.Span)
+}
+
+// An operation that does not support the data types of its operands
+type TypeMismatchError struct {
+	Span     tokenizer.Span
+	Op       string // The operator or construct, eg. "+" or "index"
+	Operands []datatype.DataType
+	Msg      string
+
+	operand int // The operand at fault, 1 for the first one, 0 if not known
+}
+
+func (e *TypeMismatchError) Error() string {
+	return errorAt(e.Msg, e.Span)
+}
+
+// The data types of the operands, eg. "Int32 and Bool"
+func (e *TypeMismatchError) OperandTypes() string {
+	types := make([]string, len(e.Operands))
+	for i, op := range e.Operands {
+		types[i] = op.DataType()
+	}
+	return strings.Join(types, " and ")
+}
+
+// Create a type mismatch error for an operator that can't be applied to its
+// operands
+func operandsMismatch(op string, operands ...datatype.DataType) *TypeMismatchError {
+	e := &TypeMismatchError{Op: op, Operands: operands}
+	e.Msg = fmt.Sprintf("Cannot perform operation '%s' on %s", op, e.OperandTypes())
+	return e
+}
+
+// Create a type mismatch error with a custom message
+func typeMismatch(op string, operand datatype.DataType, format string, args ...interface{}) *TypeMismatchError {
+	return &TypeMismatchError{Op: op, Operands: []datatype.DataType{operand}, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Record that the nth operand of the operation, counting from 1, caused the
+// error
+func (e *TypeMismatchError) causedBy(n int) *TypeMismatchError {
+	e.operand = n
+	return e
+}
+
+// An index outside of a list or string
+type IndexOutOfRangeError struct {
+	Span   tokenizer.Span
+	Index  int
+	Length int
+}
+
+func (e *IndexOutOfRangeError) Error() string {
+	if e.Index >= e.Length {
+		return errorAt(fmt.Sprintf("Index %d is greater than length %d", e.Index, e.Length), e.Span)
+	}
+	return errorAt(fmt.Sprintf("Computed index %d is lesser than 0", e.Index+e.Length), e.Span)
+}
+
+// Arguments to an intrinsic method that don't match any of its signatures or
+// are otherwise invalid
+type ArgumentError struct {
+	Span   tokenizer.Span
+	Method string
+	Args   []datatype.DataType
+	Msg    string
+}
+
+func (e *ArgumentError) Error() string {
+	if e.Method != "" {
+		return errorAt(fmt.Sprintf("%s: %s", e.Method, e.Msg), e.Span)
+	}
+	return errorAt(e.Msg, e.Span)
+}
+
+// An arithmetic operation whose result doesn't fit in its data type, eg.
+// -(-9223372036854775808) for an Int
+type OverflowError struct {
+	Span     tokenizer.Span
+	Op       string
+	Operands []datatype.DataType
+	Type     string // Data type of the result
+}
+
+func (e *OverflowError) Error() string {
+	return errorAt(fmt.Sprintf("%s overflow in %s", e.Type, operationText(e.Op, e.Operands)), e.Span)
+}
+
+// A division or modulo by zero
+type DivisionByZeroError struct {
+	Span     tokenizer.Span
+	Op       string
+	Operands []datatype.DataType
+}
+
+func (e *DivisionByZeroError) Error() string {
+	return errorAt(fmt.Sprintf("Division by zero in %s", operationText(e.Op, e.Operands)), e.Span)
+}
+
+// The operation with its operands, eg. "1 / 0" or "-(5)". Long operands are
+// shortened.
+func operationText(op string, operands []datatype.DataType) string {
+	texts := make([]string, len(operands))
+	for i, operand := range operands {
+		texts[i] = datatype.ToPrint(operand)
+		if len(texts[i]) > 40 {
+			texts[i] = texts[i][:20] + "..." + texts[i][len(texts[i])-10:]
+		}
+	}
+	if len(texts) == 1 {
+		return fmt.Sprintf("%s(%s)", op, texts[0])
+	}
+	return strings.Join(texts, " "+op+" ")
+}
+
+// An error that occurred while evaluating part of an expression that isn't
+// one of the more specific errors
+type EvalError struct {
+	Span tokenizer.Span // The part of the expression that failed
+	Err  error
+}
+
+func (e *EvalError) Error() string {
+	return errorAt(e.Err.Error(), e.Span)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+func (e *UnknownSymbolError) Code() string   { return ErrorCodeUnknownSymbol }
+func (e *UnknownFunctionError) Code() string { return ErrorCodeUnknownFunction }
+func (e *TypeMismatchError) Code() string    { return ErrorCodeTypeMismatch }
+func (e *IndexOutOfRangeError) Code() string { return ErrorCodeIndexOutOfRange }
+func (e *ArgumentError) Code() string        { return ErrorCodeArgument }
+func (e *OverflowError) Code() string        { return ErrorCodeOverflow }
+func (e *DivisionByZeroError) Code() string  { return ErrorCodeDivisionByZero }
+func (e *EvalError) Code() string            { return ErrorCodeRuntime }
+
+func (e *UnknownSymbolError) ErrorSpan() tokenizer.Span   { return e.Span }
+func (e *UnknownFunctionError) ErrorSpan() tokenizer.Span { return e.Span }
+func (e *TypeMismatchError) ErrorSpan() tokenizer.Span    { return e.Span }
+func (e *IndexOutOfRangeError) ErrorSpan() tokenizer.Span { return e.Span }
+func (e *ArgumentError) ErrorSpan() tokenizer.Span        { return e.Span }
+func (e *OverflowError) ErrorSpan() tokenizer.Span        { return e.Span }
+func (e *DivisionByZeroError) ErrorSpan() tokenizer.Span  { return e.Span }
+func (e *EvalError) ErrorSpan() tokenizer.Span            { return e.Span }
+
+// Errors that are caused by one operand of an operation. causeOperand is 1
+// for the first operand, and 0 if the cause is not known.
+type operandCause interface {
+	causeOperand() int
+}
+
+func (e *TypeMismatchError) causeOperand() int    { return e.operand }
+func (e *IndexOutOfRangeError) causeOperand() int { return 2 } // The index
+func (e *DivisionByZeroError) causeOperand() int  { return 2 } // The divisor
+
+// The operand that caused err, or 0 if it is not known
+func causeOperand(err error) int {
+	var c operandCause
+	if errors.As(err, &c) {
+		return c.causeOperand()
+	}
+	return 0
+}
+
+// Find out which operand of a binary operation has the wrong type, if err is
+// a mismatch that doesn't say. It is the operand that isn't accepted by the
+// operator, eg. true in 1 + true, because 1 + 1 is fine and true + true isn't.
+func findMismatchedOperand(err error, op string, op1, op2 datatype.DataType) error {
+	e, ok := err.(*TypeMismatchError)
+	if !ok || e.operand != 0 || len(e.Operands) != 2 {
+		return err
+	}
+
+	_, err1 := BinaryOperator(op, op1, op1)
+	_, err2 := BinaryOperator(op, op2, op2)
+	switch {
+	case err1 == nil && err2 != nil:
+		e.operand = 2
+	case err1 != nil && err2 == nil:
+		e.operand = 1
+	}
+	return e
+}
+
+func (e *UnknownSymbolError) setSpan(s tokenizer.Span)   { e.Span = s }
+func (e *UnknownFunctionError) setSpan(s tokenizer.Span) { e.Span = s }
+func (e *TypeMismatchError) setSpan(s tokenizer.Span)    { e.Span = s }
+func (e *IndexOutOfRangeError) setSpan(s tokenizer.Span) { e.Span = s }
+func (e *ArgumentError) setSpan(s tokenizer.Span)        { e.Span = s }
+func (e *OverflowError) setSpan(s tokenizer.Span)        { e.Span = s }
+func (e *DivisionByZeroError) setSpan(s tokenizer.Span)  { e.Span = s }
+
+// Errors that are created without a span, which is filled in by the evaluator
+type spanSetter interface {
+	Error
+	setSpan(tokenizer.Span)
+}
+
+// Attach the span of the node being evaluated to err. Errors that already have
+// a span keep it, so the span is that of the innermost node that failed.
+func withSpan(err error, span tokenizer.Span) error {
+	var e Error
+	if !errors.As(err, &e) {
+		return &EvalError{Span: span, Err: err}
+	}
+
+	if s, ok := e.(spanSetter); ok && s.ErrorSpan() == (tokenizer.Span{}) {
+		s.setSpan(span)
+	}
+	return err
+}
+
+// Append the position to an error message, if it is known
+func errorAt(msg string, span tokenizer.Span) string {
+	if span.Start.Line == 0 {
+		return msg
+	}
+	return fmt.Sprintf("%s at %s", msg, span)
+}
@@ -0,0 +1,140 @@
+package evaluator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorSpanIsOperand(t *testing.T) {
+	tests := []struct {
+		text         string
+		line, column int
+	}{
+		{"1 +\n  true", 2, 3},
+		{"true +\n 1", 1, 1},
+		{"[1,\n 2,\n 3]{7}", 3, 5},
+		{"[1, 2]{\n \"a\"}", 2, 2},
+		{"true{\n 1}", 1, 1},
+		{"x +\n  (1 ?\n 2 : 3)", 2, 4},
+		{"10 /\n (x - 1)", 2, 3},
+		{"2.5M #\n 0M", 2, 2},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.text)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.text, err)
+		}
+		_, err = p.Eval(NewEnv(NewScope(GlobalSymbols, map[string]interface{}{"x": 1})))
+		var e Error
+		if !errors.As(err, &e) {
+			t.Errorf("%q: expected an Error, got %v", tt.text, err)
+			continue
+		}
+		if start := e.ErrorSpan().Start; start.Line != tt.line || start.Column != tt.column {
+			t.Errorf("%q: error at %s, want line %d, column %d", tt.text, start, tt.line, tt.column)
+		}
+	}
+}
+
+func TestArithmeticErrorCodes(t *testing.T) {
+	tests := map[string]string{
+		"9223372036854775807 + x":     ErrorCodeOverflow,
+		"-(-9223372036854775807 - x)": ErrorCodeOverflow,
+		"-2562047h - 1h":              ErrorCodeOverflow,
+		"1 / (x - 1)":                 ErrorCodeDivisionByZero,
+		"1 # 0":                       ErrorCodeDivisionByZero,
+		"1e999M * 10M":                ErrorCodeOverflow,
+		"1.5M / 0M":                   ErrorCodeDivisionByZero,
+		"1h / 0":                      ErrorCodeDivisionByZero,
+	}
+	for text, want := range tests {
+		p, err := Compile(text)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", text, err)
+		}
+		_, err = p.Eval(NewEnv(NewScope(GlobalSymbols, map[string]interface{}{"x": 1})))
+		var e Error
+		if !errors.As(err, &e) || e.Code() != want {
+			t.Errorf("%s: got error %v, want code %s", text, err, want)
+		}
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	type order struct{ Total int }
+	env := NewEnv(NewScope(GlobalSymbols, map[string]interface{}{"x": 1, "o": order{5}}))
+	eval := func(text string) error {
+		p, err := Compile(text)
+		if err != nil {
+			return err
+		}
+		_, err = p.Eval(env)
+		return err
+	}
+
+	tests := []struct {
+		text  string
+		code  string
+		check func(err error) bool
+	}{
+		{"1 +", ErrorCodeSyntax, func(err error) bool {
+			var e *SyntaxError
+			return errors.As(err, &e) && e.Span.Start.Column == 4
+		}},
+		{"(1", ErrorCodeSyntax, func(err error) bool {
+			var e *SyntaxError
+			return errors.As(err, &e)
+		}},
+		{`"abc`, ErrorCodeSyntax, func(err error) bool {
+			var e *SyntaxError
+			return errors.As(err, &e) && e.Msg == `Missing closing quote for: "abc`
+		}},
+		{"Nope + 1", ErrorCodeUnknownSymbol, func(err error) bool {
+			var e *UnknownSymbolError
+			return errors.As(err, &e) && e.Name == "Nope" && e.Target == ""
+		}},
+		{"(o).Missing", ErrorCodeUnknownSymbol, func(err error) bool {
+			var e *UnknownSymbolError
+			return errors.As(err, &e) && e.Name == "Missing" && e.Target != ""
+		}},
+		{"Nope(1)", ErrorCodeUnknownFunction, func(err error) bool {
+			var e *UnknownFunctionError
+			return errors.As(err, &e) && e.Name == "Nope"
+		}},
+		{`Abs("a")`, ErrorCodeArgument, func(err error) bool {
+			var e *ArgumentError
+			return errors.As(err, &e) && e.Method == "Abs" && len(e.Args) == 1
+		}},
+		{"Round(1.5, -1)", ErrorCodeArgument, func(err error) bool {
+			var e *ArgumentError
+			return errors.As(err, &e) && e.Method == "Round"
+		}},
+		{"[1, 2]{5}", ErrorCodeIndexOutOfRange, func(err error) bool {
+			var e *IndexOutOfRangeError
+			return errors.As(err, &e) && e.Index == 5 && e.Length == 2
+		}},
+		{`"ab"{-3}`, ErrorCodeIndexOutOfRange, func(err error) bool {
+			var e *IndexOutOfRangeError
+			return errors.As(err, &e) && e.Index == -3 && e.Length == 2
+		}},
+		{"1 + true", ErrorCodeTypeMismatch, func(err error) bool {
+			var e *TypeMismatchError
+			return errors.As(err, &e) && e.Op == "+" && e.OperandTypes() == "Int32 and Bool"
+		}},
+		{"x / 0", ErrorCodeDivisionByZero, func(err error) bool {
+			var e *DivisionByZeroError
+			return errors.As(err, &e) && e.Op == "/"
+		}},
+	}
+	for _, tt := range tests {
+		err := eval(tt.text)
+		var e Error
+		if !errors.As(err, &e) || e.Code() != tt.code {
+			t.Errorf("%q: got error %v, want code %s", tt.text, err, tt.code)
+			continue
+		}
+		if !tt.check(err) {
+			t.Errorf("%q: got %T %+v", tt.text, err, err)
+		}
+	}
+}
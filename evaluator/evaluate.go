@@ -3,100 +3,232 @@ package evaluator
 import (
 	"fmt"
 
+	"github.com/contactkeval/expressioneval/ast"
 	"github.com/contactkeval/expressioneval/datatype"
+	"github.com/contactkeval/expressioneval/parser"
 	"github.com/contactkeval/expressioneval/tokenizer"
 )
 
-// Main evaluate function. This first converts the tokens to a postfix
-// expression and then evaluates that expression.
+// Main evaluate function. This first parses the tokens into a syntax tree and
+// then evaluates that tree.
 func Evaluate(tokens tokenizer.Tokens) (datatype.DataType, error) {
-	pf, err := convertToPostfix(tokens)
+	n, err := parser.Parse(tokens)
 	if err != nil {
 		return nil, err
 	}
 
-	v, err := evaluatePostfix(&pf)
-	return v, err
+	return EvaluateNode(n, nil)
 }
 
-// Evaluate the postfix expression and return the result
-func evaluatePostfix(pfe *PostfixExpression) (datatype.DataType, error) {
-	if pfe.Empty() {
-		return nil, fmt.Errorf("Invalid expression")
+// Evaluate a syntax tree and return the result. The tree is not modified, so
+// it can be evaluated again. Symbols are looked up in env, or in the global
+// SymbolTable if env is nil.
+func EvaluateNode(n ast.Node, env *Env) (datatype.DataType, error) {
+	if env == nil {
+		env = defaultEnv
 	}
-	el := pfe.Pop()
-
-	switch v := el.(type) {
-	case tokenizer.Symbol:
-		return SymbolOperator(pfe, v)
-	case tokenizer.Comma:
-		return CommaOperator(pfe)
-	case tokenizer.Colon:
-		return ColonOperator(pfe)
-	case tokenizer.Question:
-		return QuestionOperator(pfe)
-	case tokenizer.ArithmeticOperator:
-		return ArithmeticAndRelationalOperator(pfe, v)
-	case tokenizer.RelationalOperator:
-		return ArithmeticAndRelationalOperator(pfe, v)
-	case tokenizer.LogicalOperator:
-		return LogicalOperator(pfe, v)
-	case datatype.DataType:
-		return v, nil
-	case Indexify:
-		return IndexifyOperator(pfe)
-	case Listify:
-		return ListifyOperator(pfe)
-	case tokenizer.IntrinsicMethod:
-		return IntrinsicMethodOperator(pfe, v)
-	case tokenizer.TypeCast:
-		valToCast, err := evaluatePostfix(pfe)
+	if n == nil {
+		return nil, fmt.Errorf("Failed to evaluate expression: no syntax tree")
+	}
+
+	ev := newEvaluation(env)
+	return ev.evaluate(n)
+}
+
+// State of a single evaluation. Nothing in here is shared between
+// evaluations, which makes it safe to evaluate the same tree concurrently.
+type evaluation struct {
+	env     *Env
+	symbols Resolver
+	values  map[string]datatype.DataType // The symbols resolved so far
+}
+
+// Set up an evaluation in a copy of env whose clock is read at most once
+func newEvaluation(env *Env) *evaluation {
+	e := *env
+	e.Clock = &onceClock{clock: env.clock()}
+	return &evaluation{env: &e, symbols: e.symbols()}
+}
+
+// Evaluate a node. Errors carry the span of the innermost node that failed.
+func (ev *evaluation) evaluate(n ast.Node) (datatype.DataType, error) {
+	v, err := ev.evaluateNode(n)
+	if err != nil {
+		return nil, withSpan(err, n.SourceSpan())
+	}
+	return v, nil
+}
+
+func (ev *evaluation) evaluateNode(n ast.Node) (datatype.DataType, error) {
+	switch v := n.(type) {
+	case *ast.Literal:
+		return v.Value, nil
+	case *ast.Symbol:
+		return ev.symbol(v.Name)
+	case *ast.Unary:
+		op, err := ev.evaluate(v.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return UnaryOperator(v.Op, op)
+	case *ast.Binary:
+		op1, err := ev.evaluate(v.Left)
 		if err != nil {
-			return nil, fmt.Errorf("Failed to type cast: %v", err)
-		}
-
-		var c datatype.DataType
-
-		if l, isList := valToCast.(datatype.List); isList {
-			switch v.CastDataType() {
-			case datatype.DataTypeString:
-				c, err = l.AllToString()
-			case datatype.DataTypeBool:
-				c, err = l.AllToBool()
-			case datatype.DataTypeDouble:
-				c, err = l.AllToDouble()
-			case datatype.DataTypeChar:
-				c, err = l.AllToChar()
-			case datatype.DataTypeInt:
-				c, err = l.AllToInt()
-			default:
-				panic("Can't convert to " + v.CastDataType())
+			return nil, err
+		}
+		// && and || don't evaluate the right operand if the left one already
+		// decides the result. & and | always evaluate both operands.
+		if b, ok := op1.(datatype.Bool); ok {
+			if (v.Op == "&&" && !bool(b)) || (v.Op == "||" && bool(b)) {
+				return b, nil
 			}
-		} else {
-			switch v.CastDataType() {
-			case datatype.DataTypeString:
-				c, err = datatype.ToString(valToCast)
-			case datatype.DataTypeBool:
-				c, err = datatype.ToBool(valToCast)
-			case datatype.DataTypeDouble:
-				c, err = datatype.ToDouble(valToCast)
-			case datatype.DataTypeChar:
-				c, err = datatype.ToChar(valToCast)
-			case datatype.DataTypeInt:
-				c, err = datatype.ToInt(valToCast)
-			case datatype.DataTypeDateTime:
-				c, err = datatype.ToDateTime(valToCast)
-			default:
-				panic("Can't convert to " + v.CastDataType())
+		}
+		// Neither does ?? if the left operand isn't null
+		if v.Op == tokenizer.NullCoalescingOperator && !datatype.IsNull(op1) {
+			return op1, nil
+		}
+		op2, err := ev.evaluate(v.Right)
+		if err != nil {
+			return nil, err
+		}
+		if op1, op2, err = ev.dateTimeOperands(v, op1, op2); err != nil {
+			return nil, err
+		}
+		res, err := binaryOperator(ev.env.decimalContext(), v.Op, op1, op2)
+		if err != nil {
+			return nil, operandError(findMismatchedOperand(err, v.Op, op1, op2), v.Left, v.Right)
+		}
+		return res, nil
+	case *ast.Call:
+		args, err := ev.evaluateNodes(v.Args)
+		if err != nil {
+			return nil, err
+		}
+		return callIntrinsicMethod(ev.env, v.Name, args)
+	case *ast.List:
+		items, err := ev.evaluateNodes(v.Items)
+		if err != nil {
+			return nil, err
+		}
+		// Text in a list of DateTimes is parsed as set up in the environment
+		if nl := datatype.List(items).WithoutNulls(); len(nl) > 0 && datatype.IsDateTime(nl[0]) {
+			for i, item := range items {
+				if items[i], err = parseDateTimes(ev.env, item); err != nil {
+					return nil, withSpan(err, v.Items[i].SourceSpan())
+				}
 			}
 		}
-
-		if err == nil {
-			return c, nil
-		} else {
+		return ListifyOperator(items)
+	case *ast.Map:
+		values, err := ev.evaluateNodes(v.Values)
+		if err != nil {
+			return nil, err
+		}
+		return MapifyOperator(v.Keys, values)
+	case *ast.Index:
+		opl, err := ev.evaluate(v.Target)
+		if err != nil {
+			return nil, err
+		}
+		opi, err := ev.evaluate(v.Index)
+		if err != nil {
+			return nil, err
+		}
+		res, err := IndexifyOperator(opl, opi)
+		if err != nil {
+			return nil, operandError(err, v.Target, v.Index)
+		}
+		return res, nil
+	case *ast.Member:
+		op, err := ev.evaluate(v.Target)
+		if err != nil {
+			return nil, err
+		}
+		return MemberOperator(op, v.Name)
+	case *ast.Conditional:
+		cond, err := ev.evaluate(v.Cond)
+		if err != nil {
+			return nil, err
+		}
+		// Only the branch that is picked is evaluated
+		branch, err := ConditionalOperator(cond, v.True, v.False)
+		if err != nil {
+			return nil, withSpan(err, v.Cond.SourceSpan())
+		}
+		return ev.evaluate(branch)
+	case *ast.Cast:
+		valToCast, err := ev.evaluate(v.Operand)
+		if err != nil {
 			return nil, err
 		}
+		// Text is parsed as set up in the environment
+		if v.DataType == datatype.DataTypeDateTime {
+			if valToCast, err = parseDateTimes(ev.env, valToCast); err != nil {
+				return nil, err
+			}
+		}
+		return TypeCastOperator(v.DataType, valToCast)
+	}
+	return nil, fmt.Errorf("Failed to evaluate expression: unknown node %v", n)
+}
+
+// The value of a symbol. Each symbol is resolved once per evaluation, so a Go
+// value is only converted once however often it is referenced.
+func (ev *evaluation) symbol(name string) (datatype.DataType, error) {
+	if v, ok := ev.values[name]; ok {
+		return v, nil
+	}
+
+	v, err := SymbolOperator(ev.symbols, name)
+	if err != nil {
+		return nil, err
+	}
+	if ev.values == nil {
+		ev.values = map[string]datatype.DataType{}
+	}
+	ev.values[name] = v
+	return v, nil
+}
+
+// The operands of a binary operator, with a String that is compared with a
+// DateTime parsed as set up in the environment
+func (ev *evaluation) dateTimeOperands(v *ast.Binary, op1, op2 datatype.DataType) (datatype.DataType, datatype.DataType, error) {
+	if _, relational := compareResult(v.Op, 0); !relational {
+		return op1, op2, nil
+	}
+
+	var err error
+	switch {
+	case datatype.IsDateTime(op1) && datatype.IsString(op2):
+		if op2, err = parseDateTimes(ev.env, op2); err != nil {
+			return nil, nil, withSpan(err, v.Right.SourceSpan())
+		}
+	case datatype.IsString(op1) && datatype.IsDateTime(op2):
+		if op1, err = parseDateTimes(ev.env, op1); err != nil {
+			return nil, nil, withSpan(err, v.Left.SourceSpan())
+		}
+	}
+	return op1, op2, nil
+}
+
+// Attach the span of the operand that caused err, if it is known, so that the
+// error points at the part of the expression that is wrong
+func operandError(err error, operands ...ast.Node) error {
+	if i := causeOperand(err); i > 0 && i <= len(operands) {
+		return withSpan(err, operands[i-1].SourceSpan())
+	}
+	return err
+}
 
+// Evaluate each node in a list of nodes
+func (ev *evaluation) evaluateNodes(nodes []ast.Node) ([]datatype.DataType, error) {
+	vals := make([]datatype.DataType, 0, len(nodes))
+	for _, n := range nodes {
+		v, err := ev.evaluate(n)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
 	}
-	return nil, fmt.Errorf("Failed to evaluate postfix expression")
+	return vals, nil
 }
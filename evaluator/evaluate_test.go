@@ -0,0 +1,542 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/contactkeval/expressioneval/datatype"
+	"github.com/contactkeval/expressioneval/parser"
+)
+
+// An environment with a method Spy that counts its calls, and a variable x
+// that is 0
+func spyEnv(t *testing.T, calls *int) *Env {
+	fs := NewFunctionSet(DefaultFunctions)
+	err := fs.Register("Spy", "", func(args ...datatype.DataType) (datatype.DataType, error) {
+		*calls++
+		return datatype.Bool(true), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnv(NewScope(GlobalSymbols, map[string]interface{}{"x": 0}))
+	env.Functions = fs
+	return env
+}
+
+func TestShortCircuitSkipsOperand(t *testing.T) {
+	tests := map[string]string{
+		"false && Spy()":           "false",
+		"true || Spy()":            "true",
+		"true ? 1 : Spy()":         "1",
+		"false ? Spy() : 2":        "2",
+		"?(true : 1, Spy())":       "1",
+		"?(false : Spy(), 2)":      "2",
+		"x <> 0 && 10 / x > 1":     "false",
+		"x = 0 || 10 / x > 1":      "true",
+		"(1 > 2 && Spy()) || true": "true",
+	}
+	for text, want := range tests {
+		calls := 0
+		env := spyEnv(t, &calls)
+		p, err := Compile(text)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", text, err)
+		}
+		v, err := p.Eval(env)
+		if err != nil {
+			t.Errorf("%s: %v", text, err)
+			continue
+		}
+		if got := datatype.ToPrint(v); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+		if calls != 0 {
+			t.Errorf("%s called Spy %d times, want 0", text, calls)
+		}
+	}
+}
+
+func TestShortCircuitEvaluatesNeededOperand(t *testing.T) {
+	for _, text := range []string{"true && Spy()", "false || Spy()", "false ? 1 : Spy()", "?(true : Spy(), 1)"} {
+		calls := 0
+		env := spyEnv(t, &calls)
+		p, err := Compile(text)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", text, err)
+		}
+		if _, err := p.Eval(env); err != nil {
+			t.Errorf("%s: %v", text, err)
+		}
+		if calls != 1 {
+			t.Errorf("%s called Spy %d times, want 1", text, calls)
+		}
+	}
+}
+
+// Evaluate text in the default environment and print the result, or the
+// error prefixed with "error: "
+func evalPrint(text string) string {
+	return evalPrintIn(NewEnv(GlobalSymbols), text)
+}
+
+func evalPrintIn(env *Env, text string) string {
+	p, err := Compile(text)
+	if err == nil {
+		var v datatype.DataType
+		if v, err = p.Eval(env); err == nil {
+			return datatype.ToPrint(v)
+		}
+	}
+	return "error: " + err.Error()
+}
+
+func TestStringsAreIndexedByRune(t *testing.T) {
+	tests := map[string]string{
+		`Length("héllo")`:              "5",
+		`"héllo"{1}`:                   "é",
+		`"héllo"{-4}`:                  "é",
+		`"héllo"{1:3}`:                 "éll",
+		`"日本語"{2}`:                     "語",
+		`Sort(['é', 'a', 'ü'])`:        "[a, é, ü]",
+		`IndexOf("héllo", "l")`:        "2",
+		`IndexOf("héllo", "l", 3)`:     "3",
+		`IndexOf("héllo", ["o", "é"])`: "1",
+		`IndexOf("héllo", "x")`:        "-1",
+	}
+	for text, want := range tests {
+		if got := evalPrint(text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestDecimalLimits(t *testing.T) {
+	for _, text := range []string{
+		`1e100000000M`,
+		`<M>"1e50000000"`,
+		`Pv(100M, 5, 2000000)`,
+		`Pva(100M, 5, -2000000)`,
+		`Round(1.5M, 100000000)`,
+		`1e999M * 1e999M`,
+	} {
+		if got := evalPrint(text); !strings.HasPrefix(got, "error: ") {
+			t.Errorf("%s = %s, want an error", text, got)
+		}
+	}
+	if got, want := evalPrint(`Apy(5M, 2000000)`), "5.1271095718979616"; got != want {
+		t.Errorf("Apy(5M, 2000000) = %s, want %s", got, want)
+	}
+}
+
+func TestDecimalContext(t *testing.T) {
+	down := NewEnv(GlobalSymbols)
+	down.DecimalContext = &datatype.DecimalContext{DivisionScale: 2, Rounding: datatype.RoundDown}
+	halfUp := NewEnv(GlobalSymbols)
+	halfUp.DecimalContext = &datatype.DecimalContext{DivisionScale: 6, Rounding: datatype.RoundHalfUp}
+
+	tests := []struct {
+		text                    string
+		byDefault, down, halfUp string
+	}{
+		{"2M / 3M", "0.6666666666666667", "0.66", "0.666667"},
+		{"10M / 4M", "2.5", "2.5", "2.5"},
+		{"1M / 3", "0.3333333333333333", "0.33", "0.333333"},
+		{"Round(2.5M)", "2", "2", "3"},
+		{"Round(-2.55M, 1)", "-2.6", "-2.5", "-2.6"},
+		{`Round(2.5M, 0, "HalfEven")`, "2", "2", "2"},
+		{"Round(2.5)", "2", "2", "3"},
+		{"Dpr(10M, 2023)", "0.0002739726027397", "0.00", "0.000274"},
+		{"Pv(100M, 5, 1)", "95.2380952380952381", "95.23", "95.238095"},
+	}
+	for _, tt := range tests {
+		if got := evalPrint(tt.text); got != tt.byDefault {
+			t.Errorf("%s = %s by default, want %s", tt.text, got, tt.byDefault)
+		}
+		if got := evalPrintIn(down, tt.text); got != tt.down {
+			t.Errorf("%s = %s rounding down to 2 digits, want %s", tt.text, got, tt.down)
+		}
+		if got := evalPrintIn(halfUp, tt.text); got != tt.halfUp {
+			t.Errorf("%s = %s rounding half up to 6 digits, want %s", tt.text, got, tt.halfUp)
+		}
+	}
+}
+
+func TestRoundNegativeDigits(t *testing.T) {
+	for _, text := range []string{
+		"Round(15, -1)",
+		"Round(1.5, -1)",
+		"Round(15M, -1)",
+		`Round(15M, -1, "HalfUp")`,
+	} {
+		p, err := Compile(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = p.Eval(nil)
+		var ae *ArgumentError
+		if !errors.As(err, &ae) || ae.Msg != "Number of digits -1 is negative" {
+			t.Errorf("%s: got error %v, want an ArgumentError for the digits", text, err)
+		}
+	}
+}
+
+// Lists of numbers have the widest type of their items, so none are
+// truncated
+func TestListLiteralTypes(t *testing.T) {
+	tests := map[string]string{
+		"[1, 2]":                "Int32[] [1, 2]",
+		"[1, 2.5]":              "Double[] [1, 2.5]",
+		"[2.5, 1]":              "Double[] [2.5, 1]",
+		"[null, 1, 2.5]":        "Double[] [null, 1, 2.5]",
+		"[1, 2.5M]":             "Decimal[] [1, 2.5]",
+		"[2.5, 1, 0.1M]":        "Decimal[] [2.5, 1, 0.1]",
+		"[1, 2.5]{1}":           "Double 2.5",
+		`["a", 1]`:              "String[] [a, 1]",
+		"[1h, 2h]":              "Duration[] [1h, 2h]",
+		"[9007199254740993, 1]": "Int32[] [9007199254740993, 1]",
+	}
+	for text, want := range tests {
+		p, err := Compile(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := p.Eval(nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", text, err)
+			continue
+		}
+		if got := v.DataType() + " " + datatype.ToPrint(v); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestValueEquality(t *testing.T) {
+	tests := map[string]string{
+		`@{"a": 1.5M} = @{"a": 1.50M}`:  "true",
+		`@{"a": 1} = @{"a": 1.0}`:       "true",
+		`@{"a": [1]} <> @{"a": [1, 2]}`: "true",
+		`@{"a": 1} = @{"b": 1}`:         "false",
+		`[1.5M] = [1.50M]`:              "true",
+		`Distinct([1.5M, 1.50M, 2M])`:   "[1.5, 2]",
+		`[1.5M, 2M] - [1.50M]`:          "[2]",
+		`[[1], [2]] ^ [[2]]`:            "[[2]]",
+	}
+	for text, want := range tests {
+		if got := evalPrint(text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestJsonSelectReturnsValues(t *testing.T) {
+	tests := map[string]string{
+		`JsonSelect(JSONString, "store.book[0].author")`:   "Nigel Rees",
+		`JsonSelect(JSONString, "store.book[1].price")`:    "12.99",
+		`JsonSelect(JSONString, "store.bicycle"){"color"}`: "red",
+		`Keys(JsonSelect(JSONString, "store.bicycle"))`:    "[color, price]",
+		`Length(JsonSelect(JSONString, "store.book"))`:     "4",
+		`JsonSelect(JSONString, "store.book[0].isbn")`:     "null",
+		`JsonSelect("[1, 2]", "[1]")`:                      "2",
+	}
+	for text, want := range tests {
+		if got := evalPrint(text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestValueResolverMaps(t *testing.T) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"order": {"id": 7, "lines": [{"sku": "A"}, {"sku": "B"}]}}`), &data); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewValueResolver(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		`Keys(order)`:            "[id, lines]",
+		`HasKey(order, "lines")`: "true",
+		`order{"lines"}{1}.sku`:  "B",
+		`order.id = 7`:           "true",
+		`order.missing`:          "null",
+	}
+	for text, want := range tests {
+		p, err := Compile(text)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", text, err)
+		}
+		v, err := p.Eval(NewEnv(r))
+		if err != nil {
+			t.Errorf("%s: %v", text, err)
+			continue
+		}
+		if got := datatype.ToPrint(v); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestDateTimeArithmeticAcrossDST(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	env := NewEnv(GlobalSymbols)
+	env.Location = paris
+
+	// Daylight saving time starts on 2024-03-31 at 2:00 in Paris
+	tests := map[string]string{
+		`(<H>"2024-03-31" + 1).Hour`:               "0",
+		`(<H>"2024-03-30 12:00" + 1).Hour`:         "12",
+		`(<H>"2024-04-01" - 1).Hour`:               "0",
+		`(<H>"2024-03-30 12:00" + 24h).Hour`:       "12",
+		`(<H>"2024-04-01" - <H>"2024-03-31").Days`: "1",
+		`(<H>"2024-03-31 01:30" + 1h).Hour`:        "3",
+		`<H>"2024-03-31 12:00" - <H>"2024-03-31"`:  "12h",
+		`(<H>"2024-03-31 12:00").TimeOfDay`:        "12h",
+		`<H>"2024-03-30 18:00" + (<H>"2024-04-02 07:15" - <H>"2024-03-30 18:00") = <H>"2024-04-02 07:15"`: "true",
+	}
+	for text, want := range tests {
+		if got := evalPrintIn(env, text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestDateTimeTextUsesEnv(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	env := NewEnv(GlobalSymbols)
+	env.Location = paris
+	env.DateTimeLayouts = []string{"02/01/2006"}
+
+	tests := map[string]string{
+		`<H>"31/03/2024"`:                                     "2024-03-31T00:00:00+01:00",
+		`<H>["31/03/2024", "01/04/2024"]{1}`:                  "2024-04-01T00:00:00+02:00",
+		`[<H>"31/03/2024", "01/04/2024"]{1}.Day`:              "1",
+		`<H>"31/03/2024" < "01/04/2024"`:                      "true",
+		`"31/03/2024" = <H>"31/03/2024"`:                      "true",
+		`<H>"2024-03-31"`:                                     "error: Cannot convert '2024-03-31' to DateTime at line 1, column 1",
+		`<H>"31/03/2024" + 12h = <H>"31/03/2024" + 0.5 * 24h`: "true",
+	}
+	for text, want := range tests {
+		if got := evalPrintIn(env, text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestDateTimePrintRoundTrips(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	env := NewEnv(NewScope(GlobalSymbols, map[string]interface{}{
+		"d": time.Date(2024, 3, 31, 0, 0, 0, 0, paris),
+		"t": time.Date(2024, 3, 31, 15, 4, 5, 500, time.FixedZone("", -5*60*60)),
+	}))
+	env.Location = time.UTC
+
+	for _, text := range []string{`<H>ToString(d) = d`, `<H>ToString(t) = t`} {
+		if got := evalPrintIn(env, text); got != "true" {
+			t.Errorf("%s = %s, want true", text, got)
+		}
+	}
+}
+
+// The deepest expressions the parser accepts can be evaluated
+func TestEvaluateMaxDepth(t *testing.T) {
+	tests := map[string]string{
+		"1" + strings.Repeat(" + 1", parser.MaxDepth-2):                                       strconv.Itoa(parser.MaxDepth - 1),
+		strings.Repeat("(", parser.MaxDepth-1) + "2" + strings.Repeat(")", parser.MaxDepth-1): "2",
+		strings.Repeat("-", parser.MaxDepth-1) + "1":                                          "-1",
+	}
+	for text, want := range tests {
+		if got := evalPrint(text); got != want {
+			t.Errorf("%.20s... = %.50s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestDateIntrinsics(t *testing.T) {
+	env := NewEnv(GlobalSymbols)
+	env.Location = time.UTC
+	tests := map[string]string{
+		`DateAdd(<H>"2024-01-31", 1, "months")`:                                 "2024-02-29T00:00:00Z",
+		`DateAdd(<H>"2024-02-29", -1, "year")`:                                  "2023-02-28T00:00:00Z",
+		`DateAdd(<H>"2024-03-15T10:00:00Z", 90, "minutes")`:                     "2024-03-15T11:30:00Z",
+		`DateDiff(<H>"2024-01-31", <H>"2024-02-29", "month")`:                   "1",
+		`DateDiff(<H>"2024-02-29", <H>"2024-01-29", "months")`:                  "-1",
+		`DateDiff(<H>"2024-02-29", <H>"2024-01-31", "months")`:                  "0",
+		`DateDiff(<H>"2024-01-01", <H>"2024-12-31", "quarter")`:                 "3",
+		`DateDiff(<H>"2024-03-15", <H>"2024-03-22", "weekdays")`:                `error: DateDiff: Unknown date unit 'weekdays' at line 1, column 1`,
+		`StartOfMonth(<H>"2024-02-15T10:00:00Z")`:                               "2024-02-01T00:00:00Z",
+		`EndOfMonth(<H>"2024-02-15T10:00:00Z")`:                                 "2024-02-29T00:00:00Z",
+		`EndOfMonth(<H>"2023-02-15")`:                                           "2023-02-28T00:00:00Z",
+		`IsLeapYear(1900) || !IsLeapYear(2000)`:                                 "false",
+		`IsoWeek(<H>"2024-12-30")`:                                              "1",
+		`IsoWeekYear(<H>"2024-12-30")`:                                          "2025",
+		`IsoWeek(<H>"2021-01-03")`:                                              "53",
+		`Quarter(<H>"2024-08-01")`:                                              "3",
+		`Weekday(<H>"2024-03-17")`:                                              "0",
+		`[Year(<H>"2024-03-05"), Month(<H>"2024-03-05"), Day(<H>"2024-03-05")]`: "[2024, 3, 5]",
+		`FormatDate(<H>"2024-03-05", "02/01/2006")`:                             "05/03/2024",
+		`FormatDateTime(<H>"2024-03-05T14:07:09Z", "2006-01-02 15:04")`:         "2024-03-05 14:07",
+		`ParseDateTime("05/03/2024 14:07", "02/01/2006 15:04")`:                 "2024-03-05T14:07:00Z",
+		`ToUtc(<H>"2024-03-05T14:07:09+02:00")`:                                 "2024-03-05T12:07:09Z",
+		`ToTimeZone(<H>"2024-03-05T14:07:09Z", "Europe/Paris")`:                 "2024-03-05T15:07:09+01:00",
+	}
+	for text, want := range tests {
+		if got := evalPrintIn(env, text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+// DateAdd, DateDiff and subtracting DateTimes agree on the length of a day
+// with a daylight saving time change
+func TestDateIntrinsicsAcrossDST(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	env := NewEnv(NewScope(GlobalSymbols, map[string]interface{}{
+		"start": time.Date(2024, 3, 30, 12, 0, 0, 0, paris),
+		"end":   time.Date(2024, 3, 31, 12, 0, 0, 0, paris),
+	}))
+	env.Location = paris
+
+	tests := map[string]string{
+		`DateDiff(start, end, "hours")`:     "24",
+		`DateDiff(start, end, "day")`:       "1",
+		`end - start`:                       "1d",
+		`DateAdd(start, 24, "hours")`:       "2024-03-31T12:00:00+02:00",
+		`DateAdd(start, 1, "day") = end`:    "true",
+		`DateAdd(end, -24, "hour") = start`: "true",
+	}
+	for text, want := range tests {
+		if got := evalPrintIn(env, text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+// && and || use three-valued logic: null is an unknown Bool, so the result is
+// only null if the known operand doesn't decide it
+func TestNullLogic(t *testing.T) {
+	values := []string{"true", "false", "null"}
+	and := [][]string{
+		{"true", "false", "null"},
+		{"false", "false", "false"},
+		{"null", "false", "null"},
+	}
+	or := [][]string{
+		{"true", "true", "true"},
+		{"true", "false", "null"},
+		{"true", "null", "null"},
+	}
+	for i, a := range values {
+		for j, b := range values {
+			for _, op := range []string{"&&", "&"} {
+				text := a + " " + op + " " + b
+				if got := evalPrint(text); got != and[i][j] {
+					t.Errorf("%s = %s, want %s", text, got, and[i][j])
+				}
+			}
+			for _, op := range []string{"||", "|"} {
+				text := a + " " + op + " " + b
+				if got := evalPrint(text); got != or[i][j] {
+					t.Errorf("%s = %s, want %s", text, got, or[i][j])
+				}
+			}
+		}
+	}
+	if got := evalPrint("!null"); got != "null" {
+		t.Errorf("!null = %s, want null", got)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	tests := map[string]string{
+		"null ?? 1":                  "1",
+		"1 ?? 2":                     "1",
+		"null ?? null":               "null",
+		"null ?? null ?? 3":          "3",
+		"null ?? 2 ?? 3":             "2",
+		"false ?? true":              "false",
+		"null ?? 1 + 1":              "2",
+		"(null ?? 2) * 3":            "6",
+		"null || null ?? true":       "true",
+		"[null, 1]{0} ?? \"x\"":      "x",
+		"Coalesce(null, null, 3, 4)": "3",
+		"Coalesce(null)":             "null",
+		"Coalesce()":                 "null",
+		"IsNull(null)":               "true",
+		"IsNull(0)":                  "false",
+		"IsNull(\"\")":               "false",
+		"IsNull(null ?? 1)":          "false",
+	}
+	for text, want := range tests {
+		if got := evalPrint(text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestTernary(t *testing.T) {
+	env := NewEnv(NewScope(GlobalSymbols, map[string]interface{}{"x": -5}))
+	tests := map[string]string{
+		"true ? 1 : 2":                               "1",
+		"false ? 1 : 2":                              "2",
+		"true ? 1 : false ? 2 : 3":                   "1",
+		"false ? 1 : false ? 2 : 3":                  "3",
+		"false ? 1 : true ? 2 : 3":                   "2",
+		"true ? false ? 1 : 2 : 3":                   "2",
+		`x > 0 ? "pos" : x < 0 ? "neg" : "zero"`:     "neg",
+		"(x < 0 ? 10 : 20) + 1":                      "11",
+		"x < 0 ? 10 : 20 + 1":                        "10",
+		"null ? 1 : 2":                               "2",
+		`?(x < 0 : "neg", "pos")`:                    "neg",
+		`?(x > 0 : "pos", ?(x < 0 : "neg", "zero"))`: "neg",
+		"1 ? 2 : 3":                                  "error: Conditional expects a Bool condition instead of Int32 at line 1, column 1",
+		`"true" ? 2 : 3`:                             "error: Conditional expects a Bool condition instead of String at line 1, column 1",
+		"?(1 : 2, 3)":                                "error: Conditional expects a Bool condition instead of Int32 at line 1, column 3",
+	}
+	for text, want := range tests {
+		if got := evalPrintIn(env, text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+// A method returns null for a null argument, but only if the call would
+// otherwise match one of its signatures
+func TestNullArguments(t *testing.T) {
+	tests := map[string]string{
+		`Length(null)`:          "null",
+		`StartsWith(null, "a")`: "null",
+		`StartsWith("a", null)`: "null",
+		`Round(1.25, null)`:     "null",
+		`IsNull(null, 1)`:       "error",
+		`Length(null, 1)`:       "error",
+		`StartsWith(null, 1)`:   "error",
+		`Round(null, "x")`:      "error",
+		`ToUpper(null, null)`:   "error",
+	}
+	for text, want := range tests {
+		got := evalPrint(text)
+		if want == "error" && !strings.HasPrefix(got, "error: ") || want != "error" && got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
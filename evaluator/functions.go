@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/contactkeval/expressioneval/datatype"
+)
+
+// Implementation of an intrinsic method. The arguments have already been
+// checked against the signature the method was registered with.
+type Func func(args ...datatype.DataType) (datatype.DataType, error)
+
+// A set of intrinsic methods that can be called by expressions. A set can have
+// a parent, whose methods are available unless the set defines a method with
+// the same name. This allows an environment to add to or override the default
+// methods without affecting other environments.
+type FunctionSet struct {
+	parent *FunctionSet
+
+	mu      sync.RWMutex
+	methods map[string]intrinsicMethod
+}
+
+// The built-in intrinsic methods. Evaluations use this set if their
+// environment does not have one.
+var DefaultFunctions *FunctionSet
+
+// NewFunctionSet creates an empty set that falls back to parent, which can be
+// nil
+func NewFunctionSet(parent *FunctionSet) *FunctionSet {
+	return &FunctionSet{parent: parent, methods: map[string]intrinsicMethod{}}
+}
+
+// Register adds a method to the set. The signature uses the same type codes
+// as the built-in methods (see polyTypeCheckedMethod), eg. "S,LS,BF". To
+// support several signatures, pass more signature and func pairs after the
+// first one. A name can only be registered once per set, but it can override
+// a method of the parent set.
+func (fs *FunctionSet) Register(name string, signature string, fn Func, more ...interface{}) error {
+	typesAndFuncs := []interface{}{signature, fn}
+	typesAndFuncs = append(typesAndFuncs, more...)
+
+	if len(typesAndFuncs)%2 != 0 {
+		return fmt.Errorf("Method %s: signatures and funcs should be passed in pairs", name)
+	}
+
+	for i := 0; i < len(typesAndFuncs); i += 2 {
+		sig, ok := typesAndFuncs[i].(string)
+		if !ok {
+			return fmt.Errorf("Method %s: expected a signature instead of %v", name, typesAndFuncs[i])
+		}
+		if err := checkSignature(sig); err != nil {
+			return fmt.Errorf("Method %s: %v", name, err)
+		}
+
+		// polyTypeCheckedMethod expects plain funcs
+		switch f := typesAndFuncs[i+1].(type) {
+		case Func:
+			typesAndFuncs[i+1] = (func(args ...datatype.DataType) (datatype.DataType, error))(f)
+		case func(args ...datatype.DataType) (datatype.DataType, error):
+		default:
+			return fmt.Errorf("Method %s: expected a func for signature '%s'", name, sig)
+		}
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, exists := fs.methods[name]; exists {
+		return fmt.Errorf("Method %s is already registered", name)
+	}
+	fs.methods[name] = polyTypeCheckedMethod(typesAndFuncs...)
+
+	return nil
+}
+
+// Check if a method is available in the set or its parents
+func (fs *FunctionSet) Has(name string) bool {
+	_, err := fs.lookup(name)
+	return err == nil
+}
+
+func (fs *FunctionSet) lookup(name string) (intrinsicMethod, error) {
+	for s := fs; s != nil; s = s.parent {
+		s.mu.RLock()
+		meth, exists := s.methods[name]
+		s.mu.RUnlock()
+
+		if exists {
+			return meth, nil
+		}
+	}
+	return nil, &UnknownFunctionError{Name: name}
+}
+
+// RegisterFunc adds a method to DefaultFunctions, making it available to all
+// environments that don't have their own function set
+func RegisterFunc(name string, signature string, fn Func, more ...interface{}) error {
+	return DefaultFunctions.Register(name, signature, fn, more...)
+}
+
+func GetIntrinsicMethod(name string) (intrinsicMethod, error) {
+	return DefaultFunctions.lookup(name)
+}
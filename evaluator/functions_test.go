@@ -0,0 +1,35 @@
+package evaluator
+
+import (
+	"testing"
+
+	"github.com/contactkeval/expressioneval/datatype"
+)
+
+func TestRegisterWithoutArguments(t *testing.T) {
+	fs := NewFunctionSet(DefaultFunctions)
+	err := fs.Register("Answer", "", func(args ...datatype.DataType) (datatype.DataType, error) {
+		return datatype.Int(42), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := NewEnv(GlobalSymbols)
+	env.Functions = fs
+	for text, want := range map[string]string{"Answer()": "42", "Answer() + 1": "43"} {
+		p, err := Compile(text)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", text, err)
+		}
+		v, err := p.Eval(env)
+		if err != nil || datatype.ToPrint(v) != want {
+			t.Errorf("%s = %v, %v, want %s", text, v, err, want)
+		}
+	}
+
+	p, _ := Compile("Answer(1)")
+	if _, err := p.Eval(env); err == nil {
+		t.Error("Answer(1) should fail, it takes no arguments")
+	}
+}
@@ -0,0 +1,55 @@
+package evaluator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/contactkeval/expressioneval/datatype"
+	"github.com/contactkeval/expressioneval/parser"
+	"github.com/contactkeval/expressioneval/tokenizer"
+)
+
+// Tokenize, parse and evaluate any text without panicking. The seed corpus
+// is in testdata/fuzz/FuzzEvaluate. Run with
+//
+//	go test ./evaluator -run xxx -fuzz FuzzEvaluate
+func FuzzEvaluate(f *testing.F) {
+	for _, s := range []string{
+		`1 + 2 * 3`,
+		`[1, 2, 3]{0:1}`,
+		`?(1 > 2 : 'a', "b")`,
+		`1 > 2 ? "a" : "b"`,
+		`<I>"12"`,
+		`Max([])`,
+		`"abc"{2:0}`,
+		`99999999999999999999999`,
+		`1.5M / 3M`,
+		`null ?? 1`,
+		`@{"a": [1, 2], b: null}.a{1}`,
+		`<H>"2024-03-31" + 2h30m`,
+		`DateAdd(DateTime.Today, 1, "month")`,
+	} {
+		f.Add(s)
+	}
+
+	// No web pages are fetched while fuzzing
+	fs := NewFunctionSet(DefaultFunctions)
+	fs.Register("GetWebPage", "S,S", func(args ...datatype.DataType) (datatype.DataType, error) {
+		return args[1], nil
+	})
+	env := NewEnv(GlobalSymbols)
+	env.Functions = fs
+	env.Clock = FixedClock(time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC))
+
+	f.Fuzz(func(t *testing.T, s string) {
+		tokens, err := tokenizer.Tokenize(s)
+		if err != nil {
+			return
+		}
+		n, err := parser.Parse(tokens)
+		if err != nil {
+			return
+		}
+		EvaluateNode(n, env)
+	})
+}
@@ -0,0 +1,195 @@
+package evaluator
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/contactkeval/expressioneval/datatype"
+)
+
+// The most days a single holiday event in an iCalendar file can span
+const maxHolidayDays = 366
+
+// LoadHolidays reads the holidays in a local file, which is either an
+// iCalendar file (.ics) or a CSV file (.csv). See ReadHolidaysICS and
+// ReadHolidaysCSV for the formats.
+func LoadHolidays(path string) ([]Holiday, error) {
+	var read func(io.Reader) ([]Holiday, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ics":
+		read = ReadHolidaysICS
+	case ".csv":
+		read = ReadHolidaysCSV
+	default:
+		return nil, fmt.Errorf("Cannot load holidays from %s: expected an .ics or .csv file", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	holidays, err := read(f)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load holidays from %s: %v", path, err)
+	}
+	return holidays, nil
+}
+
+// ReadHolidaysCSV reads holidays from CSV records with the date in the first
+// field and an optional name in the second, eg. 2024-12-25,Christmas Day.
+// The dates can have any of the datatype.DefaultDateTimeLayouts. The first
+// record is skipped if it is a header, and lines starting with # are
+// comments.
+func ReadHolidaysCSV(r io.Reader) ([]Holiday, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var holidays []Holiday
+	for first := true; ; first = false {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		date, err := datatype.ParseDateTime(rec[0], datatype.DefaultDateTimeLayouts, time.UTC)
+		if err != nil {
+			if first {
+				continue
+			}
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("Line %d: %v", line, err)
+		}
+
+		h := Holiday{Date: time.Time(date)}
+		if len(rec) > 1 {
+			h.Name = strings.TrimSpace(rec[1])
+		}
+		holidays = append(holidays, h)
+	}
+	return holidays, nil
+}
+
+// ReadHolidaysICS reads the events of an iCalendar file as holidays. Every
+// day from the DTSTART of an event up to its DTEND is a holiday, with the
+// SUMMARY as its name. Recurring events are not supported, so each year's
+// holidays have to be listed.
+func ReadHolidaysICS(r io.Reader) ([]Holiday, error) {
+	lines, err := unfoldICS(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var holidays []Holiday
+	var start, end time.Time
+	var name string
+	inEvent := false
+
+	for _, l := range lines {
+		prop, value := splitICSLine(l.text)
+		switch {
+		case prop == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			start, end, name, inEvent = time.Time{}, time.Time{}, "", true
+		case !inEvent:
+			continue
+		case prop == "END" && strings.EqualFold(value, "VEVENT"):
+			if start.IsZero() {
+				return nil, fmt.Errorf("Line %d: event without a DTSTART", l.num)
+			}
+			if !end.After(start) {
+				end = start.AddDate(0, 0, 1)
+			}
+			if end.After(start.AddDate(0, 0, maxHolidayDays)) {
+				return nil, fmt.Errorf("Line %d: event is longer than %d days", l.num, maxHolidayDays)
+			}
+			for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+				holidays = append(holidays, Holiday{Date: d, Name: name})
+			}
+			inEvent = false
+		case prop == "DTSTART" || prop == "DTEND":
+			d, err := parseICSDate(value)
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: %v", l.num, err)
+			}
+			if prop == "DTSTART" {
+				start = d
+			} else {
+				end = d
+			}
+		case prop == "SUMMARY":
+			name = unescapeICS(value)
+		case prop == "RRULE" || prop == "RDATE":
+			return nil, fmt.Errorf("Line %d: recurring events are not supported", l.num)
+		}
+	}
+
+	if inEvent {
+		return nil, fmt.Errorf("Event without an END:VEVENT")
+	}
+	return holidays, nil
+}
+
+// A content line of an iCalendar file, and the line number it starts on
+type icsLine struct {
+	text string
+	num  int
+}
+
+// Read the content lines of an iCalendar file. Long lines are folded by
+// continuing them on lines that start with a space or a tab.
+func unfoldICS(r io.Reader) ([]icsLine, error) {
+	var lines []icsLine
+	scanner := bufio.NewScanner(r)
+	for num := 1; scanner.Scan(); num++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1].text += text[1:]
+			continue
+		}
+		if text != "" {
+			lines = append(lines, icsLine{text: text, num: num})
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// The upper case name of a property, without its parameters, and its value,
+// eg. DTSTART and 20241225 for DTSTART;VALUE=DATE:20241225
+func splitICSLine(line string) (string, string) {
+	name, value := line, ""
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		name, value = line[:i], line[i+1:]
+	}
+	if i := strings.IndexByte(name, ';'); i >= 0 {
+		name = name[:i]
+	}
+	return strings.ToUpper(name), value
+}
+
+// The date of a DATE or DATE-TIME value, eg. 20241225 or 20241225T000000Z
+func parseICSDate(value string) (time.Time, error) {
+	if len(value) >= 8 {
+		if t, err := time.Parse("20060102", value[:8]); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s'", value)
+}
+
+var icsUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, `;`, `\,`, `,`, `\n`, "\n", `\N`, "\n")
+
+func unescapeICS(s string) string {
+	return icsUnescaper.Replace(s)
+}
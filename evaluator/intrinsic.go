@@ -2,29 +2,31 @@ package evaluator
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"net/http"
-	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/contactkeval/expressioneval/datatype"
 	"github.com/contactkeval/expressioneval/tokenizer"
 )
 
-// Supported intrinsic methods
-var intrinsicMethods map[string]intrinsicMethod
-
 // Set up all intrinsic methods
 func init() {
-	intrinsicMethods = map[string]intrinsicMethod{
+	DefaultFunctions = &FunctionSet{methods: map[string]intrinsicMethod{
 		"Abs": polyTypeCheckedMethod(
+			"M", func(args ...datatype.DataType) (datatype.DataType, error) {
+				if v := toDecimal(args[0]); v.Sign() < 0 {
+					return v.Neg(), nil
+				}
+				return args[0], nil
+			},
 			"N", func(args ...datatype.DataType) (datatype.DataType, error) {
 				return datatype.Double(math.Abs(toFloat(args[0]))), nil
 			}),
@@ -40,11 +42,29 @@ func init() {
 				}
 				return datatype.String(s), nil
 			}),
-		"Apy": polyTypeCheckedMethod(
-			"N,N", func(args ...datatype.DataType) (datatype.DataType, error) {
-				r, p := toFloat(args[0]), toFloat(args[1])
-				return datatype.Double(100 * (math.Pow((1+(r/100)/p), p) - 1)), nil
-			}),
+		"Apy": envMethod(func(env *Env) intrinsicMethod {
+			return polyTypeCheckedMethod(
+				"M,I", func(args ...datatype.DataType) (datatype.DataType, error) {
+					r, p := toDecimal(args[0]), toInt(args[1])
+					if p <= 0 {
+						return nil, &ArgumentError{Args: args, Msg: "Number of periods must be positive"}
+					}
+					// 100 * ((1 + r/100/p)^p - 1), with enough digits in r/100/p that
+					// raising it to the power p doesn't change the result
+					ctx := env.decimalContext()
+					scale := ctx.DivisionScale + decimalGuardDigits + len(strconv.Itoa(p))
+					f, _ := r.Mul(datatype.NewDecimal(1, 2)).Quo(datatype.NewDecimal(int64(p), 0), scale, ctx.Rounding)
+					x, err := decimalPow(datatype.NewDecimal(1, 0).Add(f), p, scale, ctx.Rounding)
+					if err != nil {
+						return nil, err
+					}
+					return x.Sub(datatype.NewDecimal(1, 0)).Mul(datatype.NewDecimal(100, 0)).Round(ctx.DivisionScale, ctx.Rounding), nil
+				},
+				"N,N", func(args ...datatype.DataType) (datatype.DataType, error) {
+					r, p := toFloat(args[0]), toFloat(args[1])
+					return datatype.Double(100 * (math.Pow((1+(r/100)/p), p) - 1)), nil
+				})
+		}),
 		"Avg": polyTypeCheckedMethod(
 			"LN", func(args ...datatype.DataType) (datatype.DataType, error) {
 				l := toSlice(args[0])
@@ -55,6 +75,14 @@ func init() {
 				}
 				return datatype.Double(sum / float64(len(l))), nil
 			}),
+		"Coalesce": intrinsicMethodFunc(func(args ...datatype.DataType) (datatype.DataType, error) {
+			for _, arg := range args {
+				if !datatype.IsNull(arg) {
+					return arg, nil
+				}
+			}
+			return datatype.Null{}, nil
+		}),
 		"Contains": polyTypeCheckedMethod(
 			"S,S,B", func(args ...datatype.DataType) (datatype.DataType, error) {
 				haystack, needle, ignoreCase := toString(args[0]), toString(args[1]), toBool(args[2])
@@ -98,7 +126,7 @@ func init() {
 						if s, ok := needle.(datatype.String); ok && ignoreCase {
 							needle = datatype.String(strings.ToLower(toString(s)))
 						}
-						if reflect.DeepEqual(haystack, needle) {
+						if valuesEqual(haystack, needle) {
 							contained++
 							break
 						}
@@ -111,32 +139,111 @@ func init() {
 				return datatype.Bool(contained > 0), nil
 			},
 		),
+		"AddBusinessDays": envMethod(func(env *Env) intrinsicMethod {
+			addBusinessDays := func(args ...datatype.DataType) (datatype.DataType, error) {
+				dt, count := args[0].(datatype.DateTime), toInt(args[1])
+				cal, err := calendarArg(env, args, 2)
+				if err != nil {
+					return nil, err
+				}
+				res, err := dt.AddBusinessDays(count, cal.IsBusinessDay)
+				if err != nil {
+					return nil, &ArgumentError{Args: args, Msg: err.Error()}
+				}
+				return res, nil
+			}
+			return polyTypeCheckedMethod("H,I", addBusinessDays, "H,I,S", addBusinessDays)
+		}),
+		"BusinessDaysBetween": envMethod(func(env *Env) intrinsicMethod {
+			businessDaysBetween := func(args ...datatype.DataType) (datatype.DataType, error) {
+				start, end := args[0].(datatype.DateTime), args[1].(datatype.DateTime)
+				cal, err := calendarArg(env, args, 2)
+				if err != nil {
+					return nil, err
+				}
+				n, err := start.BusinessDaysUntil(end, cal.IsBusinessDay)
+				if err != nil {
+					return nil, &ArgumentError{Args: args, Msg: err.Error()}
+				}
+				return datatype.Int(n), nil
+			}
+			return polyTypeCheckedMethod("H,H", businessDaysBetween, "H,H,S", businessDaysBetween)
+		}),
+		"DateAdd": envMethod(func(env *Env) intrinsicMethod {
+			return polyTypeCheckedMethod(
+				"H,I,S", func(args ...datatype.DataType) (datatype.DataType, error) {
+					dt, count := args[0].(datatype.DateTime), toInt(args[1])
+					unit, err := dateUnit(args)
+					if err != nil {
+						return nil, err
+					}
+
+					var res datatype.DateTime
+					if unit == datatype.UnitBusinessDay {
+						cal, _ := env.calendar("")
+						res, err = dt.AddBusinessDays(count, cal.IsBusinessDay)
+					} else {
+						res, err = dt.Add(count, unit)
+					}
+					if err != nil {
+						return nil, &ArgumentError{Args: args, Msg: err.Error()}
+					}
+					return res, nil
+				})
+		}),
+		"DateDiff": envMethod(func(env *Env) intrinsicMethod {
+			return polyTypeCheckedMethod(
+				"H,H,S", func(args ...datatype.DataType) (datatype.DataType, error) {
+					start, end := args[0].(datatype.DateTime), args[1].(datatype.DateTime)
+					unit, err := dateUnit(args)
+					if err != nil {
+						return nil, err
+					}
+
+					var n int
+					if unit == datatype.UnitBusinessDay {
+						cal, _ := env.calendar("")
+						n, err = start.BusinessDaysUntil(end, cal.IsBusinessDay)
+					} else {
+						n, err = start.Diff(end, unit)
+					}
+					if err != nil {
+						return nil, &ArgumentError{Args: args, Msg: err.Error()}
+					}
+					return datatype.Int(n), nil
+				})
+		}),
+		"Day": polyTypeCheckedMethod(
+			"H", func(args ...datatype.DataType) (datatype.DataType, error) {
+				return datatype.Int(toTime(args[0]).Day()), nil
+			}),
 		"Distinct": polyTypeCheckedMethod(
 			"L", func(args ...datatype.DataType) (datatype.DataType, error) {
 				l := toSlice(args[0])
-				var seen []datatype.DataType
+				var seen datatype.List
 
-			Outer:
 				for _, item := range l {
-					for _, s := range seen {
-						if reflect.DeepEqual(item, s) {
-							continue Outer
-						}
+					if !containsValue(seen, item) {
+						seen = append(seen, item)
 					}
-					seen = append(seen, item)
 				}
 
-				return datatype.List(seen), nil
+				return seen, nil
 			}),
-		"Dpr": polyTypeCheckedMethod(
-			"N,I0", func(args ...datatype.DataType) (datatype.DataType, error) {
-				r, y := toFloat(args[0]), toInt(args[1])
-				if y == 0 {
-					y = time.Now().Year()
-				}
-				t, _ := time.Parse("2006-01-02", strconv.Itoa(y)+"-12-31")
-
-				return datatype.Double(r / (float64(t.YearDay()) * 100)), nil
+		"Dpr": envMethod(func(env *Env) intrinsicMethod {
+			return polyTypeCheckedMethod(
+				"M,I0", func(args ...datatype.DataType) (datatype.DataType, error) {
+					r, y := toDecimal(args[0]), toInt(args[1])
+					return decimalQuo(env.decimalContext(), r, datatype.NewDecimal(int64(daysInYear(env, y)*100), 0))
+				},
+				"N,I0", func(args ...datatype.DataType) (datatype.DataType, error) {
+					r, y := toFloat(args[0]), toInt(args[1])
+					return datatype.Double(r / (float64(daysInYear(env, y)) * 100)), nil
+				})
+		}),
+		"EndOfMonth": polyTypeCheckedMethod(
+			"H", func(args ...datatype.DataType) (datatype.DataType, error) {
+				return args[0].(datatype.DateTime).EndOfMonth(), nil
 			}),
 		"EndsWith": polyTypeCheckedMethod(
 			"S,S,BF", func(args ...datatype.DataType) (datatype.DataType, error) {
@@ -175,7 +282,7 @@ func init() {
 					if ignoreCase {
 						itemStr = strings.ToLower(toString(item))
 					}
-					if reflect.DeepEqual(str, itemStr) {
+					if str == itemStr {
 						return datatype.Bool(true), nil
 					}
 				}
@@ -195,7 +302,7 @@ func init() {
 						if s, ok := needle.(datatype.String); ok && ignoreCase {
 							needle = datatype.String(strings.ToLower(toString(s)))
 						}
-						if reflect.DeepEqual(haystack, needle) {
+						if valuesEqual(haystack, needle) {
 							contained++
 							break
 						}
@@ -208,16 +315,59 @@ func init() {
 				return datatype.Bool(contained > 0), nil
 			},
 		),
+		"IsNull": intrinsicMethodFunc(func(args ...datatype.DataType) (datatype.DataType, error) {
+			if len(args) != 1 {
+				return nil, &ArgumentError{Args: args, Msg: "IsNull expects a single argument"}
+			}
+			return datatype.Bool(datatype.IsNull(args[0])), nil
+		}),
+		"IsBusinessDay": envMethod(func(env *Env) intrinsicMethod {
+			isBusinessDay := func(args ...datatype.DataType) (datatype.DataType, error) {
+				cal, err := calendarArg(env, args, 1)
+				if err != nil {
+					return nil, err
+				}
+				return datatype.Bool(cal.IsBusinessDay(toTime(args[0]))), nil
+			}
+			return polyTypeCheckedMethod("H", isBusinessDay, "H,S", isBusinessDay)
+		}),
+		"IsLeapYear": polyTypeCheckedMethod(
+			"H", func(args ...datatype.DataType) (datatype.DataType, error) {
+				return datatype.Bool(datatype.IsLeapYear(toTime(args[0]).Year())), nil
+			},
+			"I", func(args ...datatype.DataType) (datatype.DataType, error) {
+				return datatype.Bool(datatype.IsLeapYear(toInt(args[0]))), nil
+			}),
+		"IsoWeek": polyTypeCheckedMethod(
+			"H", func(args ...datatype.DataType) (datatype.DataType, error) {
+				_, week := toTime(args[0]).ISOWeek()
+				return datatype.Int(week), nil
+			}),
+		"IsoWeekYear": polyTypeCheckedMethod(
+			"H", func(args ...datatype.DataType) (datatype.DataType, error) {
+				year, _ := toTime(args[0]).ISOWeek()
+				return datatype.Int(year), nil
+			}),
+		"HasKey": polyTypeCheckedMethod(
+			"MP,S", func(args ...datatype.DataType) (datatype.DataType, error) {
+				m, key := args[0].(datatype.Map), toString(args[1])
+				_, ok := m[key]
+				return datatype.Bool(ok), nil
+			}),
 		"IndexOf": polyTypeCheckedMethod(
 			"S,S,I0,BF", func(args ...datatype.DataType) (datatype.DataType, error) {
 				str, part, startIndex, ignoreCase := toString(args[0]), toString(args[1]), toInt(args[2]), toBool(args[3])
 				if ignoreCase {
 					str, part = strings.ToLower(str), strings.ToLower(part)
 				}
+				start := runeOffset(str, startIndex)
+				if start < 0 {
+					return nil, &ArgumentError{Args: args, Msg: fmt.Sprintf("Start index %d is outside of the string", startIndex)}
+				}
 
-				idx := strings.Index(str[startIndex:], part)
+				idx := strings.Index(str[start:], part)
 				if idx >= 0 {
-					idx += startIndex
+					idx = utf8.RuneCountInString(str[:start+idx])
 				}
 				return datatype.Int(idx), nil
 			},
@@ -226,6 +376,10 @@ func init() {
 				if ignoreCase {
 					str = strings.ToLower(str)
 				}
+				start := runeOffset(str, startIndex)
+				if start < 0 {
+					return nil, &ArgumentError{Args: args, Msg: fmt.Sprintf("Start index %d is outside of the string", startIndex)}
+				}
 
 				var idx = len(str)
 
@@ -234,7 +388,7 @@ func init() {
 					if ignoreCase {
 						part = strings.ToLower(part)
 					}
-					if partIdx := strings.Index(str[startIndex:], part); partIdx >= 0 {
+					if partIdx := strings.Index(str[start:], part); partIdx >= 0 {
 						if partIdx < idx {
 							idx = partIdx
 						}
@@ -244,7 +398,7 @@ func init() {
 				if idx == len(str) {
 					idx = -1
 				} else {
-					idx += startIndex
+					idx = utf8.RuneCountInString(str[:start+idx])
 				}
 				return datatype.Int(idx), nil
 			},
@@ -257,15 +411,13 @@ func init() {
 			"S,S", func(args ...datatype.DataType) (datatype.DataType, error) {
 				j, sel := toString(args[0]), toString(args[1])
 
-				var jm map[string]interface{}
-				if err := json.Unmarshal([]byte(j), &jm); err != nil {
-					return nil, err
+				node, err := decodeJSON(j)
+				if err != nil {
+					return nil, &ArgumentError{Args: args, Msg: err.Error()}
 				}
 
 				parts := strings.Split(strings.Replace(sel, "[", ".[", -1), ".")
 
-				var node interface{} = jm
-
 				for _, part := range parts {
 					if len(part) == 0 {
 						continue
@@ -275,7 +427,9 @@ func init() {
 							idxStr := strings.Replace(strings.Replace(part, "[", "", -1), "]", "", -1)
 
 							if idx, err := strconv.Atoi(idxStr); err != nil {
-								return nil, fmt.Errorf("'%s' is not a valid index", idx)
+								return nil, fmt.Errorf("'%s' is not a valid index", idxStr)
+							} else if idx < 0 || idx >= len(arr) {
+								return nil, &IndexOutOfRangeError{Index: idx, Length: len(arr)}
 							} else {
 								node = arr[idx]
 							}
@@ -291,9 +445,20 @@ func init() {
 					}
 				}
 
-				nodeJSON, _ := json.Marshal(node)
-
-				return datatype.String(string(nodeJSON)), nil
+				return fromJSON(node), nil
+			}),
+		"FormatDate": polyTypeCheckedMethod(
+			"H", func(args ...datatype.DataType) (datatype.DataType, error) {
+				return datatype.String(toTime(args[0]).Format("2006-01-02")), nil
+			},
+			"H,S", func(args ...datatype.DataType) (datatype.DataType, error) {
+				t, layout := toTime(args[0]), toString(args[1])
+				return datatype.String(t.Format(layout)), nil
+			}),
+		"FormatDateTime": polyTypeCheckedMethod(
+			"H,S", func(args ...datatype.DataType) (datatype.DataType, error) {
+				t, layout := toTime(args[0]), toString(args[1])
+				return datatype.String(t.Format(layout)), nil
 			}),
 		"GetWebPage": polyTypeCheckedMethod(
 			"S,S", func(args ...datatype.DataType) (datatype.DataType, error) {
@@ -308,15 +473,27 @@ func init() {
 					}
 				}
 			}),
+		"Keys": polyTypeCheckedMethod(
+			"MP", func(args ...datatype.DataType) (datatype.DataType, error) {
+				m := args[0].(datatype.Map)
+				l := datatype.List{}
+				for _, k := range m.Keys() {
+					l = append(l, datatype.String(k))
+				}
+				return l, nil
+			}),
 		"Length": polyTypeCheckedMethod(
 			"S", func(args ...datatype.DataType) (datatype.DataType, error) {
 				str := toString(args[0])
-				return datatype.Int(len(str)), nil
+				return datatype.Int(utf8.RuneCountInString(str)), nil
 			},
 			"L", func(args ...datatype.DataType) (datatype.DataType, error) {
 				l := toSlice(args[0])
 				return datatype.Int(len(l)), nil
 			},
+			"MP", func(args ...datatype.DataType) (datatype.DataType, error) {
+				return datatype.Int(len(args[0].(datatype.Map))), nil
+			},
 		),
 		"Matches": polyTypeCheckedMethod(
 			"S,S", func(args ...datatype.DataType) (datatype.DataType, error) {
@@ -331,6 +508,9 @@ func init() {
 		"Max": polyTypeCheckedMethod(
 			"LN", func(args ...datatype.DataType) (datatype.DataType, error) {
 				l := toSlice(args[0])
+				if len(l) == 0 {
+					return nil, &ArgumentError{Args: args, Msg: "List is empty"}
+				}
 
 				max := toFloat(l[0])
 				for _, d := range l {
@@ -343,6 +523,9 @@ func init() {
 		"Med": polyTypeCheckedMethod(
 			"LN", func(args ...datatype.DataType) (datatype.DataType, error) {
 				l := toSlice(args[0])
+				if len(l) == 0 {
+					return nil, &ArgumentError{Args: args, Msg: "List is empty"}
+				}
 				var ln []float64
 				for _, item := range l {
 					ln = append(ln, toFloat(item))
@@ -357,6 +540,9 @@ func init() {
 		"Min": polyTypeCheckedMethod(
 			"LN", func(args ...datatype.DataType) (datatype.DataType, error) {
 				l := toSlice(args[0])
+				if len(l) == 0 {
+					return nil, &ArgumentError{Args: args, Msg: "List is empty"}
+				}
 
 				min := toFloat(l[0])
 				for _, d := range l {
@@ -366,6 +552,66 @@ func init() {
 				}
 				return datatype.Double(min), nil
 			}),
+		"Month": polyTypeCheckedMethod(
+			"H", func(args ...datatype.DataType) (datatype.DataType, error) {
+				return datatype.Int(toTime(args[0]).Month()), nil
+			}),
+		"ParseJson": polyTypeCheckedMethod(
+			"S", func(args ...datatype.DataType) (datatype.DataType, error) {
+				v, err := decodeJSON(toString(args[0]))
+				if err != nil {
+					return nil, &ArgumentError{Args: args, Msg: err.Error()}
+				}
+				return fromJSON(v), nil
+			}),
+		"NextBusinessDay": envMethod(func(env *Env) intrinsicMethod {
+			// The first business day after the date
+			nextBusinessDay := func(args ...datatype.DataType) (datatype.DataType, error) {
+				cal, err := calendarArg(env, args, 1)
+				if err != nil {
+					return nil, err
+				}
+				res, err := args[0].(datatype.DateTime).AddBusinessDays(1, cal.IsBusinessDay)
+				if err != nil {
+					return nil, &ArgumentError{Args: args, Msg: err.Error()}
+				}
+				return res, nil
+			}
+			return polyTypeCheckedMethod("H", nextBusinessDay, "H,S", nextBusinessDay)
+		}),
+		"ParseDate": envMethod(func(env *Env) intrinsicMethod {
+			return polyTypeCheckedMethod(
+				"S", func(args ...datatype.DataType) (datatype.DataType, error) {
+					dt, err := env.ParseDateTime(toString(args[0]))
+					if err != nil {
+						return nil, &ArgumentError{Args: args, Msg: err.Error()}
+					}
+					return dt.Date(), nil
+				},
+				"S,S", func(args ...datatype.DataType) (datatype.DataType, error) {
+					s, layout := toString(args[0]), toString(args[1])
+					dt, err := parseDateTime(args, s, layout, env.location())
+					if err != nil {
+						return nil, err
+					}
+					return dt.Date(), nil
+				})
+		}),
+		"ParseDateTime": envMethod(func(env *Env) intrinsicMethod {
+			return polyTypeCheckedMethod(
+				"S,S", func(args ...datatype.DataType) (datatype.DataType, error) {
+					s, layout := toString(args[0]), toString(args[1])
+					return parseDateTime(args, s, layout, env.location())
+				},
+				"S,S,S", func(args ...datatype.DataType) (datatype.DataType, error) {
+					s, layout, zone := toString(args[0]), toString(args[1]), toString(args[2])
+					loc, err := datatype.LoadLocation(zone)
+					if err != nil {
+						return nil, &ArgumentError{Args: args, Msg: err.Error()}
+					}
+					return parseDateTime(args, s, layout, loc)
+				})
+		}),
 		"Piece": polyTypeCheckedMethod(
 			"S,S,I0,I0", func(args ...datatype.DataType) (datatype.DataType, error) {
 				str, delim, startCount, lastCount := toString(args[0]), toString(args[1]), toInt(args[2]), toInt(args[3])
@@ -374,10 +620,13 @@ func init() {
 				if lastCount == 0 {
 					lastCount = len(parts)
 				}
+				if startCount < 1 {
+					startCount = 1
+				}
 				startCount--
 				lastCount--
 
-				if len(parts) <= startCount {
+				if len(parts) <= startCount || lastCount < startCount {
 					return datatype.String(""), nil
 				}
 				if len(parts) <= lastCount {
@@ -391,16 +640,93 @@ func init() {
 				n, p := toFloat(args[0]), toFloat(args[1])
 				return datatype.Double(math.Pow(n, p)), nil
 			}),
-		"Pv": polyTypeCheckedMethod(
-			"N,N,I1", func(args ...datatype.DataType) (datatype.DataType, error) {
-				n, r, p := toFloat(args[0]), toFloat(args[1]), toInt(args[2])
-				return datatype.Double(n / math.Pow(1+(r/100), float64(p))), nil
-			}),
-		"Pva": polyTypeCheckedMethod(
-			"N,N,I1", func(args ...datatype.DataType) (datatype.DataType, error) {
-				n, r, p := toFloat(args[0]), toFloat(args[1]), toInt(args[2])
-				return datatype.Double(n * ((1 - math.Pow(1+(r/100), float64(-p))) / (r / 100))), nil
+		"Pv": envMethod(func(env *Env) intrinsicMethod {
+			return polyTypeCheckedMethod(
+				"M,N,I1", func(args ...datatype.DataType) (datatype.DataType, error) {
+					n, r, p := toDecimal(args[0]), toDecimal(args[1]), toInt(args[2])
+					ctx := env.decimalContext()
+					x := interestFactor(r)
+					if p < 0 {
+						xp, err := decimalPow(x, -p, ctx.DivisionScale, ctx.Rounding)
+						if err != nil {
+							return nil, err
+						}
+						return decimalResult(n.Mul(xp))
+					}
+					xp, err := decimalPow(x, p, ctx.DivisionScale+decimalGuardDigits, ctx.Rounding)
+					if err != nil {
+						return nil, err
+					}
+					return decimalQuo(ctx, n, xp)
+				},
+				"N,N,I1", func(args ...datatype.DataType) (datatype.DataType, error) {
+					n, r, p := toFloat(args[0]), toFloat(args[1]), toInt(args[2])
+					return datatype.Double(n / math.Pow(1+(r/100), float64(p))), nil
+				})
+		}),
+		"Pva": envMethod(func(env *Env) intrinsicMethod {
+			return polyTypeCheckedMethod(
+				"M,N,I1", func(args ...datatype.DataType) (datatype.DataType, error) {
+					n, r, p := toDecimal(args[0]), toDecimal(args[1]), toInt(args[2])
+					ctx := env.decimalContext()
+					rate := r.Mul(datatype.NewDecimal(1, 2))
+					if rate.Sign() == 0 {
+						return nil, &ArgumentError{Args: args, Msg: "Rate must not be zero"}
+					}
+					// (1 - x^-p) / rate is (x^p - 1) / (x^p * rate)
+					x := interestFactor(r)
+					if p < 0 {
+						xp, err := decimalPow(x, -p, ctx.DivisionScale+decimalGuardDigits, ctx.Rounding)
+						if err != nil {
+							return nil, err
+						}
+						return decimalQuo(ctx, n.Mul(datatype.NewDecimal(1, 0).Sub(xp)), rate)
+					}
+					xp, err := decimalPow(x, p, ctx.DivisionScale+decimalGuardDigits, ctx.Rounding)
+					if err != nil {
+						return nil, err
+					}
+					return decimalQuo(ctx, n.Mul(xp.Sub(datatype.NewDecimal(1, 0))), xp.Mul(rate))
+				},
+				"N,N,I1", func(args ...datatype.DataType) (datatype.DataType, error) {
+					n, r, p := toFloat(args[0]), toFloat(args[1]), toInt(args[2])
+					return datatype.Double(n * ((1 - math.Pow(1+(r/100), float64(-p))) / (r / 100))), nil
+				})
+		}),
+		"Quarter": polyTypeCheckedMethod(
+			"H", func(args ...datatype.DataType) (datatype.DataType, error) {
+				return datatype.Int((toTime(args[0]).Month()-1)/3 + 1), nil
 			}),
+		"Round": envMethod(func(env *Env) intrinsicMethod {
+			return polyTypeCheckedMethod(
+				"M,I0", func(args ...datatype.DataType) (datatype.DataType, error) {
+					return roundDecimal(toDecimal(args[0]), toInt(args[1]), env.decimalContext().Rounding)
+				},
+				"M,I,S", func(args ...datatype.DataType) (datatype.DataType, error) {
+					mode, err := datatype.ParseRoundingMode(toString(args[2]))
+					if err != nil {
+						return nil, &ArgumentError{Args: args, Msg: err.Error()}
+					}
+					return roundDecimal(toDecimal(args[0]), toInt(args[1]), mode)
+				},
+				"I,I0", func(args ...datatype.DataType) (datatype.DataType, error) {
+					if digits := toInt(args[1]); digits < 0 {
+						return nil, &ArgumentError{Args: args, Msg: fmt.Sprintf("Number of digits %d is negative", digits)}
+					}
+					return args[0], nil
+				},
+				"D,I0", func(args ...datatype.DataType) (datatype.DataType, error) {
+					v, err := datatype.ToDecimal(args[0])
+					if err != nil {
+						return nil, &ArgumentError{Args: args, Msg: err.Error()}
+					}
+					res, err := roundDecimal(v, toInt(args[1]), env.decimalContext().Rounding)
+					if err != nil {
+						return nil, err
+					}
+					return res.ToDouble()
+				})
+		}),
 		"Replace": polyTypeCheckedMethod(
 			"S,S,S", func(args ...datatype.DataType) (datatype.DataType, error) {
 				str, from, to := toString(args[0]), toString(args[1]), toString(args[2])
@@ -424,8 +750,12 @@ func init() {
 			}),
 		"Sort": polyTypeCheckedMethod(
 			"L", func(args ...datatype.DataType) (datatype.DataType, error) {
-				l := toSlice(args[0])
+				all := datatype.List(toSlice(args[0]))
+				l := all.WithoutNulls()
 				res := datatype.List{}
+				if len(l) == 0 {
+					return all, nil
+				}
 
 				switch t := l[0].DataType(); t {
 				case datatype.DataTypeString:
@@ -435,10 +765,10 @@ func init() {
 						res = append(res, datatype.String(item))
 					}
 				case datatype.DataTypeChar:
-					ls := toStringSlice(l)
-					sort.Strings(ls)
+					ls := toRuneSlice(l)
+					sort.Slice(ls, func(i, j int) bool { return ls[i] < ls[j] })
 					for _, item := range ls {
-						res = append(res, datatype.Char(item[0]))
+						res = append(res, datatype.Char(item))
 					}
 				case datatype.DataTypeInt:
 					ls := toIntSlice(l)
@@ -455,8 +785,16 @@ func init() {
 				default:
 					return nil, fmt.Errorf("Cannot sort  data type %s", t)
 				}
+				// Null items are moved to the end
+				for len(res) < len(all) {
+					res = append(res, datatype.Null{})
+				}
 				return res, nil
 			}),
+		"StartOfMonth": polyTypeCheckedMethod(
+			"H", func(args ...datatype.DataType) (datatype.DataType, error) {
+				return args[0].(datatype.DateTime).StartOfMonth(), nil
+			}),
 		"StartsWith": polyTypeCheckedMethod(
 			"S,S,BF", func(args ...datatype.DataType) (datatype.DataType, error) {
 				str, part, ignoreCase := toString(args[0]), toString(args[1]), toBool(args[2])
@@ -488,11 +826,11 @@ func init() {
 				ustr, err := strconv.Unquote(str)
 				return datatype.String(ustr), err
 			}),
-		"ToString": intrinsicMethodFunc(func(pfe *PostfixExpression) (datatype.DataType, error) {
-			funcArg, err := GetUnaryOperand(pfe)
-			if err != nil {
-				return nil, err
+		"ToString": intrinsicMethodFunc(func(args ...datatype.DataType) (datatype.DataType, error) {
+			if len(args) != 1 {
+				return nil, &ArgumentError{Args: args, Msg: "ToString expects a single argument"}
 			}
+			funcArg := args[0]
 
 			if vs, ok := funcArg.(interface {
 				ToString() (datatype.String, error)
@@ -501,19 +839,50 @@ func init() {
 				return s, err
 			}
 
-			return nil, fmt.Errorf("Could not convert %v to string", funcArg.DataType())
+			return nil, typeMismatch("ToString", funcArg, "Could not convert %v to string", funcArg.DataType())
 		}),
+		"ToTimeZone": polyTypeCheckedMethod(
+			"H,S", func(args ...datatype.DataType) (datatype.DataType, error) {
+				t, zone := toTime(args[0]), toString(args[1])
+				loc, err := datatype.LoadLocation(zone)
+				if err != nil {
+					return nil, &ArgumentError{Args: args, Msg: err.Error()}
+				}
+				return datatype.DateTime(t.In(loc)), nil
+			}),
+		"ToUtc": polyTypeCheckedMethod(
+			"H", func(args ...datatype.DataType) (datatype.DataType, error) {
+				return datatype.DateTime(toTime(args[0]).UTC()), nil
+			}),
 		"ToUpper": polyTypeCheckedMethod(
 			"S", func(args ...datatype.DataType) (datatype.DataType, error) {
 				str := toString(args[0])
 				ustr := strings.ToUpper(str)
 				return datatype.String(ustr), nil
 			}),
+		"Weekday": polyTypeCheckedMethod(
+			"H", func(args ...datatype.DataType) (datatype.DataType, error) {
+				// 0 is Sunday, like the DayOfWeek member
+				return datatype.Int(toTime(args[0]).Weekday()), nil
+			}),
+		"Year": polyTypeCheckedMethod(
+			"H", func(args ...datatype.DataType) (datatype.DataType, error) {
+				return datatype.Int(toTime(args[0]).Year()), nil
+			}),
+		"Values": polyTypeCheckedMethod(
+			"MP", func(args ...datatype.DataType) (datatype.DataType, error) {
+				m := args[0].(datatype.Map)
+				l := datatype.List{}
+				for _, k := range m.Keys() {
+					l = append(l, m[k])
+				}
+				return l, nil
+			}),
 		"Translate": polyTypeCheckedMethod(
 			"S,S,S", func(args ...datatype.DataType) (datatype.DataType, error) {
 				str, from, to := toString(args[0]), toString(args[1]), toString(args[2])
-				if len(from) != len(to) {
-					return nil, errors.New("'From' and 'To' arguments should have equal lengths")
+				if utf8.RuneCountInString(from) != utf8.RuneCountInString(to) {
+					return nil, &ArgumentError{Args: args, Msg: "'From' and 'To' arguments should have equal lengths"}
 				}
 				m := map[rune]rune{}
 				var frunes, trunes []rune
@@ -523,7 +892,7 @@ func init() {
 				for _, c := range to {
 					trunes = append(trunes, c)
 				}
-				for i, _ := range from {
+				for i := range frunes {
 					m[frunes[i]] = trunes[i]
 				}
 
@@ -538,5 +907,126 @@ func init() {
 
 				return datatype.String(tstr), nil
 			}),
+	}}
+}
+
+// Digits kept beyond the division scale in intermediate results, so that
+// rounding them doesn't change the final result
+const decimalGuardDigits = 8
+
+// Divide Decimals using the scale and rounding of ctx
+func decimalQuo(ctx datatype.DecimalContext, d, e datatype.Decimal) (datatype.DataType, error) {
+	res, err := d.Quo(e, ctx.DivisionScale, ctx.Rounding)
+	if err != nil {
+		return nil, &ArgumentError{Msg: err.Error()}
+	}
+	return decimalResult(res)
+}
+
+// d raised to the power n, rounded to scale digits after the decimal point
+func decimalPow(d datatype.Decimal, n int, scale int, mode datatype.RoundingMode) (datatype.Decimal, error) {
+	res, err := d.Pow(uint(n), scale, mode)
+	if err != nil {
+		return datatype.Decimal{}, &ArgumentError{Msg: fmt.Sprintf("%s to the power %d is out of range", d.ToPrint(), n)}
+	}
+	return res, nil
+}
+
+// d, or an error if it is out of the range of Decimals
+func decimalResult(d datatype.Decimal) (datatype.DataType, error) {
+	if err := d.CheckRange(); err != nil {
+		return nil, &ArgumentError{Msg: "The result is out of the range of Decimals"}
+	}
+	return d, nil
+}
+
+// 1 + r/100 for an interest rate r in percent
+func interestFactor(r datatype.Decimal) datatype.Decimal {
+	return datatype.NewDecimal(1, 0).Add(r.Mul(datatype.NewDecimal(1, 2)))
+}
+
+func roundDecimal(d datatype.Decimal, scale int, mode datatype.RoundingMode) (datatype.Decimal, error) {
+	if scale < 0 {
+		return datatype.Decimal{}, &ArgumentError{Msg: fmt.Sprintf("Number of digits %d is negative", scale)}
+	}
+	if scale > datatype.MaxDecimalScale {
+		return datatype.Decimal{}, &ArgumentError{Msg: fmt.Sprintf("Number of digits %d is more than %d", scale, datatype.MaxDecimalScale)}
+	}
+	res := d.Round(scale, mode)
+	if err := res.CheckRange(); err != nil {
+		return datatype.Decimal{}, &ArgumentError{Msg: "The result is out of the range of Decimals"}
+	}
+	return res, nil
+}
+
+// The number of days in year y, or in the current year of env if y is 0
+func daysInYear(env *Env, y int) int {
+	if y == 0 {
+		y = env.Now().Year()
+	}
+	t, _ := time.Parse("2006-01-02", strconv.Itoa(y)+"-12-31")
+	return t.YearDay()
+}
+
+// Decode a JSON value, keeping numbers as json.Number for fromJSON
+func decodeJSON(s string) (interface{}, error) {
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, fmt.Errorf("Invalid JSON: %v", err)
+	}
+	if d.More() {
+		return nil, fmt.Errorf("Invalid JSON: text after the value")
+	}
+	return v, nil
+}
+
+// Convert a value decoded from JSON with UseNumber to a data type. Objects
+// become Maps and arrays Lists. Numbers without a fraction or exponent become
+// Ints if they fit.
+func fromJSON(v interface{}) datatype.DataType {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := datatype.Map{}
+		for k, item := range v {
+			m[k] = fromJSON(item)
+		}
+		return m
+	case []interface{}:
+		l := datatype.List{}
+		for _, item := range v {
+			l = append(l, fromJSON(item))
+		}
+		return l
+	case json.Number:
+		if i, err := v.Int64(); err == nil && i >= math.MinInt && i <= math.MaxInt {
+			return datatype.Int(i)
+		}
+		f, _ := v.Float64()
+		return datatype.Double(f)
+	case string:
+		return datatype.String(v)
+	case bool:
+		return datatype.Bool(v)
+	}
+	return datatype.Null{}
+}
+
+// The date unit named by the last argument
+func dateUnit(args []datatype.DataType) (datatype.DateUnit, error) {
+	unit, err := datatype.ParseDateUnit(toString(args[len(args)-1]))
+	if err != nil {
+		return 0, &ArgumentError{Args: args, Msg: err.Error()}
+	}
+	return unit, nil
+}
+
+func parseDateTime(args []datatype.DataType, s, layout string, loc *time.Location) (datatype.DateTime, error) {
+	dt, err := datatype.ParseDateTime(s, []string{layout}, loc)
+	if err != nil {
+		return datatype.DateTime{}, &ArgumentError{Args: args, Msg: err.Error()}
 	}
+	return dt, nil
 }
@@ -3,31 +3,39 @@ package evaluator
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/contactkeval/expressioneval/datatype"
-	"github.com/davecgh/go-spew/spew"
 )
 
 // An intrinsic method
 type intrinsicMethod interface {
-	ExecuteMethod(pfe *PostfixExpression) (datatype.DataType, error)
+	ExecuteMethod(args ...datatype.DataType) (datatype.DataType, error)
 }
 
 // Simple wrapper over a func to convert it to an intrinsicMethod
-type intrinsicMethodFunc func(pfe *PostfixExpression) (datatype.DataType, error)
+type intrinsicMethodFunc func(args ...datatype.DataType) (datatype.DataType, error)
 
-func (imf intrinsicMethodFunc) ExecuteMethod(pfe *PostfixExpression) (datatype.DataType, error) {
-	return imf(pfe)
+func (imf intrinsicMethodFunc) ExecuteMethod(args ...datatype.DataType) (datatype.DataType, error) {
+	return imf(args...)
+}
+
+// An intrinsic method that depends on the environment it is called in, eg.
+// on its clock. The method is created for each call.
+type envMethod func(env *Env) intrinsicMethod
+
+func (em envMethod) ExecuteMethod(args ...datatype.DataType) (datatype.DataType, error) {
+	return em(defaultEnv).ExecuteMethod(args...)
 }
 
 // List of alternative intrinsic methods. The result is anoter intrinsicMethod
 // that calls each of the methods in the list till one of them succeeds.
 type intrinsicMethodList []intrinsicMethod
 
-func (iml intrinsicMethodList) ExecuteMethod(pfe *PostfixExpression) (datatype.DataType, error) {
+func (iml intrinsicMethodList) ExecuteMethod(args ...datatype.DataType) (datatype.DataType, error) {
 	var errs error
 	for _, im := range iml {
-		if d, err := im.ExecuteMethod(pfe); err != nil {
+		if d, err := im.ExecuteMethod(args...); err != nil {
 			if errs != nil {
 				errs = fmt.Errorf("%s\n%s", errs.Error(), err.Error())
 			} else {
@@ -52,6 +60,11 @@ func toFloat(d datatype.DataType) float64 {
 	return float64(num)
 }
 
+func toDecimal(d datatype.DataType) datatype.Decimal {
+	v, _ := datatype.ToDecimal(d)
+	return v
+}
+
 func toBool(d datatype.DataType) bool {
 	v, _ := datatype.ToBool(d)
 	return bool(v)
@@ -62,11 +75,34 @@ func toString(d datatype.DataType) string {
 	return string(v)
 }
 
+func toTime(d datatype.DataType) time.Time {
+	v, _ := d.(datatype.DateTime)
+	return time.Time(v)
+}
+
 func toRune(d datatype.DataType) rune {
 	v, _ := datatype.ToChar(d)
 	return rune(v)
 }
 
+// The byte offset of the rune with index idx in s, the length of s if idx is
+// the number of runes in s, or -1 if idx is outside of s
+func runeOffset(s string, idx int) int {
+	if idx < 0 {
+		return -1
+	}
+	for offset := range s {
+		if idx == 0 {
+			return offset
+		}
+		idx--
+	}
+	if idx == 0 {
+		return len(s)
+	}
+	return -1
+}
+
 func toSlice(d datatype.DataType) []datatype.DataType {
 	l, _ := d.(datatype.List)
 	return []datatype.DataType(l)
@@ -113,133 +149,181 @@ func toStringSlice(l datatype.List) []string {
 	return ls
 }
 
-func GetIntrinsicMethod(name string) (intrinsicMethod, error) {
-	if meth, exists := intrinsicMethods[name]; exists {
-		return meth, nil
-	} else {
-		return nil, fmt.Errorf("Method %s does not exist", name)
-	}
-}
-
 // Polymorphic methods, with some basic type checking
 // Syntax: "types1", func1, "types2", func2, ...
 //
 // Supported types:
 // S  - String
-// N  - Number (Int or Double)
+// N  - Number (Int, Double or Decimal)
 // I  - Int (I0, I1 are alternatives with a default value)
 // D  - Double
+// M  - Decimal
 // C  - Char
+// H  - DateTime
 // B  - Bool (BF, BT are alternatives with a default value)
 // L  - List
 // LS - List of strings
 // LN - List of Numbers
+// MP - Map
 //
 // Eg. S,LS,BF - func takes 3 arguments - string, list of strings and an
-// optional bool with 'false' as the default value.
+// optional bool with 'false' as the default value. The empty signature "" takes
+// no arguments.
+//
+// Null items are removed from LS and LN lists before they are passed to the
+// func. If no signature matches and one of the arguments is null, the result
+// is null.
 func polyTypeCheckedMethod(typesAndFuncs ...interface{}) intrinsicMethod {
-	return intrinsicMethodFunc(func(pfe *PostfixExpression) (datatype.DataType, error) {
-		// It's either a single operand or a single CommaList which contains a
-		// list of operands
-		funcArg, err := GetUnaryOperand(pfe)
-		if err != nil {
-			return nil, err
-		}
-
-		var args []datatype.DataType
-
-		switch v := funcArg.(type) {
-		case datatype.CommaList:
-			args = []datatype.DataType(v.Flatten())
-		default:
-			args = []datatype.DataType{v}
-		}
-
+	return intrinsicMethodFunc(func(funcArgs ...datatype.DataType) (datatype.DataType, error) {
 		unmatchedTypes := ""
 
-		tf := typesAndFuncs
-		spew.Dump(tf)
-	Outer:
-		for len(tf) >= 2 {
+		for tf := typesAndFuncs; len(tf) >= 2; tf = tf[2:] {
 			typeString, f := tf[0].(string), tf[1].(func(args ...datatype.DataType) (datatype.DataType, error))
-			tf = tf[2:]
 
-			// only used in an error message if we break out of the loop
+			// only used in an error message if no signature matches
 			unmatchedTypes = unmatchedTypes + " " + typeString
 
-			types := strings.Split(typeString, ",")
-
-			for i, arg := range args {
-				// All possible types in the type signature
-				switch types[i] {
-				case "S":
-					if _, ok := arg.(datatype.String); !ok {
-						continue Outer
-					}
-				case "N":
-					if !datatype.IsNumber(arg) {
-						continue Outer
-					}
-				case "I", "I0", "I1":
-					if _, ok := arg.(datatype.Int); !ok {
-						continue Outer
-					}
-				case "D":
-					if _, ok := arg.(datatype.Double); !ok {
-						continue Outer
-					}
-				case "C":
-					if _, ok := arg.(datatype.Char); !ok {
-						continue Outer
-					}
-				case "B", "BT", "BF":
-					if _, ok := arg.(datatype.Bool); !ok {
-						continue Outer
-					}
-				case "L":
-					if _, ok := arg.(datatype.List); !ok {
-						continue Outer
-					}
-				case "LS": // List of strings
-					if l, ok := arg.(datatype.List); !ok || !datatype.IsString(l...) {
-						continue Outer
-					}
-				case "LN": // List of numbers
-					if l, ok := arg.(datatype.List); !ok || !datatype.IsNumber(l...) {
-						continue Outer
-					}
-				default:
-					panic("Unknown type signature")
-				}
+			if args, ok := matchSignature(signatureTypeCodes(typeString), funcArgs, false); ok {
+				return f(args...)
 			}
+		}
 
-			// Special support for some default args
-			if len(types) > len(args) {
-				for i := len(args); i < len(types); i++ {
-					switch types[i] {
-					case "I0":
-						args = append(args, datatype.Int(0))
-					case "I1":
-						args = append(args, datatype.Int(1))
-					case "BT":
-						args = append(args, datatype.Bool(true))
-					case "BF":
-						args = append(args, datatype.Bool(false))
-					default:
-						break
-					}
+		// Null is only the result if the arguments would match a signature
+		// with the null arguments replaced, so the wrong number or types of
+		// arguments are still an error
+		if datatype.IsNullAny(funcArgs...) {
+			for tf := typesAndFuncs; len(tf) >= 2; tf = tf[2:] {
+				if _, ok := matchSignature(signatureTypeCodes(tf[0].(string)), funcArgs, true); ok {
+					return datatype.Null{}, nil
 				}
 			}
+		}
 
-			// This type signature did not match the number of arguments passed
-			// in
-			if len(args) != len(types) {
-				continue
+		return nil, &ArgumentError{
+			Args: funcArgs,
+			Msg:  fmt.Sprintf("Intrinsic method only accepts arguments of signatures: %s", unmatchedTypes),
+		}
+	})
+}
+
+// Check the arguments of a call against the type codes of a signature, and
+// return the arguments to pass to its func. If nullMatches is true, a null
+// argument matches any type code.
+func matchSignature(types []string, funcArgs []datatype.DataType, nullMatches bool) ([]datatype.DataType, bool) {
+	if len(funcArgs) > len(types) {
+		return nil, false
+	}
+
+	// Default args are appended per signature, so work on a copy
+	args := append([]datatype.DataType(nil), funcArgs...)
+
+	for i, arg := range args {
+		if nullMatches && datatype.IsNull(arg) {
+			continue
+		}
+
+		// All possible types in the type signature
+		switch types[i] {
+		case "S":
+			if _, ok := arg.(datatype.String); !ok {
+				return nil, false
+			}
+		case "N":
+			if !datatype.IsNumber(arg) {
+				return nil, false
+			}
+		case "I", "I0", "I1":
+			if _, ok := arg.(datatype.Int); !ok {
+				return nil, false
+			}
+		case "D":
+			if _, ok := arg.(datatype.Double); !ok {
+				return nil, false
+			}
+		case "M":
+			if _, ok := arg.(datatype.Decimal); !ok {
+				return nil, false
+			}
+		case "C":
+			if _, ok := arg.(datatype.Char); !ok {
+				return nil, false
+			}
+		case "H":
+			if _, ok := arg.(datatype.DateTime); !ok {
+				return nil, false
+			}
+		case "B", "BT", "BF":
+			if _, ok := arg.(datatype.Bool); !ok {
+				return nil, false
+			}
+		case "L":
+			if _, ok := arg.(datatype.List); !ok {
+				return nil, false
+			}
+		case "LS": // List of strings
+			l, ok := arg.(datatype.List)
+			if !ok || !datatype.IsString(l.WithoutNulls()...) {
+				return nil, false
+			}
+			args[i] = l.WithoutNulls()
+		case "MP":
+			if _, ok := arg.(datatype.Map); !ok {
+				return nil, false
+			}
+		case "LN": // List of numbers
+			l, ok := arg.(datatype.List)
+			if !ok || !datatype.IsNumber(l.WithoutNulls()...) {
+				return nil, false
 			}
+			args[i] = l.WithoutNulls()
+		default:
+			// Rejected by checkSignature, so only possible for the
+			// built-in methods
+			return nil, false
+		}
+	}
 
-			return f(args...)
+	// Special support for some default args
+	for i := len(args); i < len(types); i++ {
+		switch types[i] {
+		case "I0":
+			args = append(args, datatype.Int(0))
+		case "I1":
+			args = append(args, datatype.Int(1))
+		case "BT":
+			args = append(args, datatype.Bool(true))
+		case "BF":
+			args = append(args, datatype.Bool(false))
 		}
+	}
 
-		return nil, fmt.Errorf("Intrinsic method only accepts arguments of signatures: %s", unmatchedTypes)
-	})
+	// This type signature did not match the number of arguments passed in
+	if len(args) != len(types) {
+		return nil, false
+	}
+	return args, true
+}
+
+// The type codes that can be used in a signature of polyTypeCheckedMethod
+var signatureTypes = map[string]bool{
+	"S": true, "N": true, "I": true, "I0": true, "I1": true, "D": true, "M": true, "C": true, "H": true,
+	"B": true, "BT": true, "BF": true, "L": true, "LS": true, "LN": true, "MP": true,
+}
+
+// Check that a signature only uses known type codes
+func checkSignature(typeString string) error {
+	for _, t := range signatureTypeCodes(typeString) {
+		if !signatureTypes[t] {
+			return fmt.Errorf("Unknown type '%s' in signature '%s'", t, typeString)
+		}
+	}
+	return nil
+}
+
+// The type codes of a signature. The empty signature has no arguments.
+func signatureTypeCodes(typeString string) []string {
+	if typeString == "" {
+		return nil
+	}
+	return strings.Split(typeString, ",")
 }
@@ -1,156 +1,197 @@
 package evaluator
 
 import (
+	"errors"
 	"fmt"
 	"math"
-	"reflect"
 	"strings"
 	"time"
 
+	"github.com/contactkeval/expressioneval/ast"
 	"github.com/contactkeval/expressioneval/datatype"
 	"github.com/contactkeval/expressioneval/tokenizer"
 )
 
-// Helper methods to get operands from the postfix expression
-
-func GetUnaryOperand(pfe *PostfixExpression) (datatype.DataType, error) {
-	op, err := evaluatePostfix(pfe)
-	return op, err
-}
-
-func GetBinaryOperands(pfe *PostfixExpression) (datatype.DataType, datatype.DataType, error) {
-	op2, err := evaluatePostfix(pfe)
-
-	if err == nil {
-		op1, err := evaluatePostfix(pfe)
-		return op1, op2, err
+// Colon operator - convert a pair of ints into a range
+func ColonOperator(op1, op2 datatype.DataType) (datatype.DataType, error) {
+	if from, ok := op1.(datatype.Int); ok {
+		if to, ok := op2.(datatype.Int); ok {
+			return datatype.IntRange{From: int(from), To: int(to)}, nil
+		}
 	}
 
-	return nil, nil, err
+	return nil, operandsMismatch(":", op1, op2)
 }
 
-// Comma operator - convert comma separated values to a CommaList
-func CommaOperator(pfe *PostfixExpression) (datatype.CommaList, error) {
-	op1, op2, err := GetBinaryOperands(pfe)
-	if err != nil {
-		return nil, err
+// Conditional operator - pick one of two branches based on the condition. A
+// null condition picks the false branch.
+func ConditionalOperator(cond datatype.DataType, t, f ast.Node) (ast.Node, error) {
+	if datatype.IsNull(cond) {
+		return f, nil
 	}
-	return datatype.CommaList{op1, op2}, nil
-}
 
-// Colon operator - convert a pair of ints into a range
-func ColonOperator(pfe *PostfixExpression) (datatype.DataType, error) {
-	op1, op2, err := GetBinaryOperands(pfe)
-	if err != nil {
-		return nil, err
+	b, ok := cond.(datatype.Bool)
+	if !ok {
+		return nil, typeMismatch("?", cond, "Conditional expects a Bool condition instead of %s", cond.DataType())
 	}
 
-	if from, ok := op1.(datatype.Int); ok {
-		if to, ok := op2.(datatype.Int); ok {
-			return datatype.IntRange{int(from), int(to)}, nil
-		}
+	if b {
+		return t, nil
 	}
+	return f, nil
+}
 
-	if cond, ok := op1.(datatype.Bool); ok {
-		if cl, ok := op2.(datatype.CommaList); ok {
-			l := cl.Flatten()
-			if len(l) != 2 {
-				return nil, fmt.Errorf("Conditional Colon operator requires one item for true and one for false condtions")
-			}
+// Operations
 
-			return datatype.ConditionalValues{cond, l[0], l[1]}, nil
-		}
+// Symbol operator - get the symbol from the resolver
+func SymbolOperator(symbols Resolver, name string) (datatype.DataType, error) {
+	if symbols == nil {
+		return nil, &UnknownSymbolError{Name: name}
 	}
 
-	return nil, fmt.Errorf("Colon operator works only on Int OR Bool + CommaList")
-}
-
-func QuestionOperator(pfe *PostfixExpression) (datatype.DataType, error) {
-	v, err := GetUnaryOperand(pfe)
+	v, found, err := symbols.Resolve(name)
 	if err != nil {
 		return nil, err
 	}
-
-	if condVal, ok := v.(datatype.ConditionalValues); !ok {
-		return nil, fmt.Errorf("?(...) expects conditional values instead of %s", condVal.DataType())
-	} else {
-		if condVal.Cond {
-			return condVal.True, nil
-		} else {
-			return condVal.False, nil
-		}
+	if !found {
+		return nil, &UnknownSymbolError{Name: name}
 	}
+	return v, nil
 }
 
-// Operations
+// Member operator - get a named member of a value. All members of null are
+// null.
+func MemberOperator(op datatype.DataType, name string) (datatype.DataType, error) {
+	if datatype.IsNull(op) {
+		return op, nil
+	}
+	// A key that isn't in a map has the value null
+	if m, ok := op.(datatype.Map); ok {
+		return m.Get(name), nil
+	}
 
-// Symbol operator - get the symbol from the symbol table
-func SymbolOperator(pfe *PostfixExpression, sym tokenizer.Symbol) (datatype.DataType, error) {
-	if symVal, exists := SymbolTable[sym.TokenText()]; !exists {
-		return nil, fmt.Errorf("Could not find symbol %s (name does not exist)", sym.TokenText())
-	} else {
-		if v, ok := symVal.(datatype.DataType); !ok {
-			return nil, fmt.Errorf("Could not find symbol %s (value unexpected)", sym.TokenText())
-		} else {
-			return v, nil
-		}
+	ma, ok := op.(datatype.MemberAccessor)
+	if !ok {
+		return nil, typeMismatch(".", op, "Cannot access member %s of %s", name, op.DataType())
 	}
-}
 
-// Convert comma separated values or a single value to a list
-func ListifyOperator(pfe *PostfixExpression) (datatype.List, error) {
-	op, err := GetUnaryOperand(pfe)
+	v, found, err := ma.Member(name)
 	if err != nil {
 		return nil, err
 	}
-
-	var l datatype.List
-
-	if c, ok := op.(datatype.CommaList); ok {
-		l = c.Flatten()
-	} else {
-		l = datatype.List{op}
+	if !found {
+		return nil, &UnknownSymbolError{Name: name, Target: op.DataType()}
 	}
+	return v, nil
+}
 
+// Convert the items of a list literal to a list. All items are converted to
+// the type of the first item that isn't null. If all items are numbers, they
+// are converted like the operands of arithmetic instead, so [1, 2.5] is a
+// list of Doubles and [1, 2.5M] a list of Decimals. Items of other types, eg.
+// Duration, can't be converted and must all have the same type. Null items
+// are kept as they are.
+func ListifyOperator(items []datatype.DataType) (datatype.List, error) {
+	l := datatype.List(items)
+
+	var err error
 	var cl = l
-	if len(l) > 0 {
-		switch d := (l[0]).DataType(); d {
+	if nl := l.WithoutNulls(); len(nl) > 0 {
+		d := nl[0].DataType()
+		if datatype.IsNumber(nl...) {
+			d = widestNumberType(nl)
+		}
+		switch d {
 		case datatype.DataTypeString:
 			cl, err = l.AllToString()
 		case datatype.DataTypeBool:
 			cl, err = l.AllToBool()
 		case datatype.DataTypeDouble:
 			cl, err = l.AllToDouble()
+		case datatype.DataTypeDecimal:
+			cl, err = l.AllToDecimal()
 		case datatype.DataTypeChar:
 			cl, err = l.AllToChar()
 		case datatype.DataTypeInt:
 			cl, err = l.AllToInt()
+		case datatype.DataTypeDateTime:
+			cl, err = l.AllToDateTime()
 		default:
-			panic("Can't convert to " + d)
+			for _, item := range nl[1:] {
+				if item.DataType() != d {
+					return nil, typeMismatch("list", item, "Cannot convert %s to %s in a list of %s", item.DataType(), d, d)
+				}
+			}
 		}
 	}
 
 	return cl, err
 }
 
-// Get the element from a list at the specified index
-func IndexifyOperator(pfe *PostfixExpression) (datatype.DataType, error) {
-	opl, opi, err := GetBinaryOperands(pfe)
+// The type that all of the numbers can be converted to without losing
+// precision: Decimal if any of them is a Decimal, otherwise Double if any is a
+// Double, otherwise Int
+func widestNumberType(numbers []datatype.DataType) string {
+	d := datatype.DataTypeInt
+	for _, n := range numbers {
+		switch n.DataType() {
+		case datatype.DataTypeDecimal:
+			return datatype.DataTypeDecimal
+		case datatype.DataTypeDouble:
+			d = datatype.DataTypeDouble
+		}
+	}
+	return d
+}
 
-	if err != nil {
-		return nil, err
+// Build a map from the keys and values of a map literal
+func MapifyOperator(keys []string, values []datatype.DataType) (datatype.Map, error) {
+	if len(keys) != len(values) {
+		return nil, fmt.Errorf("Map has %d keys but %d values", len(keys), len(values))
+	}
+
+	m := datatype.Map{}
+	for i, k := range keys {
+		m[k] = values[i]
+	}
+	return m, nil
+}
+
+// Get the element from a list at the specified index, the value of a key in
+// a map or a field of an Object. Indexing null, or with a null index, gives
+// null.
+func IndexifyOperator(opl, opi datatype.DataType) (datatype.DataType, error) {
+	var err error
+
+	if datatype.IsNullAny(opl, opi) {
+		return datatype.Null{}, nil
+	}
+
+	if m, ok := opl.(datatype.Map); ok {
+		key, ok := opi.(datatype.String)
+		if !ok {
+			return nil, typeMismatch("index", opi, "Map index expects a String key instead of %s", opi.DataType()).causedBy(2)
+		}
+		return m.Get(string(key)), nil
+	}
+	if o, ok := opl.(datatype.Object); ok {
+		key, ok := opi.(datatype.String)
+		if !ok {
+			return nil, typeMismatch("index", opi, "Object index expects a String field name instead of %s", opi.DataType()).causedBy(2)
+		}
+		return MemberOperator(o, string(key))
 	}
 
 	normalizeIndex := func(idx int, length int) (int, error) {
 		nidx := idx
 		if nidx >= length {
-			return 0, fmt.Errorf("Index %d is greater than lengthgth %d", idx, length)
+			return 0, &IndexOutOfRangeError{Index: idx, Length: length}
 		}
 		if nidx < 0 {
 			nidx = length + nidx
 		}
 		if nidx < 0 {
-			return 0, fmt.Errorf("Computed index %d is lesser than 0", nidx)
+			return 0, &IndexOutOfRangeError{Index: idx, Length: length}
 		}
 
 		return nidx, nil
@@ -168,14 +209,15 @@ func IndexifyOperator(pfe *PostfixExpression) (datatype.DataType, error) {
 			return l[idx], nil
 
 		case datatype.String:
-			idx, err = normalizeIndex(idx, len(l))
+			runes := []rune(string(l))
+			idx, err = normalizeIndex(idx, len(runes))
 			if err != nil {
 				return nil, err
 			}
-			return datatype.Char(l[idx]), nil
+			return datatype.Char(runes[idx]), nil
 
 		default:
-			return nil, fmt.Errorf("Index expects a list instead of %s", opl.DataType())
+			return nil, typeMismatch("index", opl, "Index expects a list instead of %s", opl.DataType()).causedBy(1)
 		}
 	case datatype.IntRange:
 		switch l := opl.(type) {
@@ -188,58 +230,218 @@ func IndexifyOperator(pfe *PostfixExpression) (datatype.DataType, error) {
 			if err != nil {
 				return nil, err
 			}
-			return datatype.List(l[from : to+1]), nil
+			if from > to {
+				return nil, typeMismatch("index", v, "Index range %d:%d is reversed", v.From, v.To).causedBy(2)
+			}
+			// Cap the slice so that appending to it can't overwrite the source list
+			return datatype.List(l[from : to+1 : to+1]), nil
 
 		case datatype.String:
-			from, err := normalizeIndex(v.From, len(l))
+			runes := []rune(string(l))
+			from, err := normalizeIndex(v.From, len(runes))
 			if err != nil {
 				return nil, err
 			}
-			to, err := normalizeIndex(v.To, len(l))
+			to, err := normalizeIndex(v.To, len(runes))
 			if err != nil {
 				return nil, err
 			}
-			return datatype.String(l[from : to+1]), nil
+			if from > to {
+				return nil, typeMismatch("index", v, "Index range %d:%d is reversed", v.From, v.To).causedBy(2)
+			}
+			return datatype.String(runes[from : to+1]), nil
 
 		default:
-			return nil, fmt.Errorf("Index expects a list instead of %s", opl.DataType())
+			return nil, typeMismatch("index", opl, "Index expects a list instead of %s", opl.DataType()).causedBy(1)
+		}
+	default:
+		return nil, typeMismatch("index", opi, "Index expects an integer index or integer range instead of %s", opi.DataType()).causedBy(2)
+	}
+
+}
+
+// Prefix operators: logical not and numeric sign
+func UnaryOperator(op string, op1 datatype.DataType) (datatype.DataType, error) {
+	switch op {
+	case "!":
+		return LogicalNotOperator(op1)
+	case tokenizer.ArithmeticOperatorMinus:
+		switch v := op1.(type) {
+		case datatype.Null:
+			return v, nil
+		case datatype.Int:
+			if v == math.MinInt {
+				return nil, &OverflowError{Op: op, Operands: []datatype.DataType{v}, Type: datatype.DataTypeInt}
+			}
+			return -v, nil
+		case datatype.Double:
+			return -v, nil
+		case datatype.Decimal:
+			return v.Neg(), nil
+		case datatype.Duration:
+			if v == math.MinInt64 {
+				return nil, &OverflowError{Op: op, Operands: []datatype.DataType{v}, Type: datatype.DataTypeDuration}
+			}
+			return -v, nil
+		}
+	case tokenizer.ArithmeticOperatorPlus:
+		if datatype.IsNumber(op1) || datatype.IsNull(op1) {
+			return op1, nil
 		}
 	default:
-		return nil, fmt.Errorf("Index expects an integer index or integer range instead of %s", opi.DataType())
+		return nil, fmt.Errorf("Unsupported unary operator '%s'", op)
 	}
+	return nil, operandsMismatch(op, op1)
+}
 
+// Infix operators, dispatched on the operator text. Decimals are divided as
+// set by datatype.DefaultDecimalContext().
+func BinaryOperator(op string, op1, op2 datatype.DataType) (datatype.DataType, error) {
+	return binaryOperator(datatype.DefaultDecimalContext(), op, op1, op2)
 }
 
-func ArithmeticAndRelationalOperator(pfe *PostfixExpression, op tokenizer.Operator) (datatype.DataType, error) {
-	op1, op2, err := GetBinaryOperands(pfe)
+func binaryOperator(ctx datatype.DecimalContext, op string, op1, op2 datatype.DataType) (datatype.DataType, error) {
+	switch op {
+	case tokenizer.NullCoalescingOperator:
+		return CoalesceOperator(op1, op2)
+	case "&&", "&", "||", "|":
+		return LogicalOperator(op, op1, op2)
+	}
+	if datatype.IsNullAny(op1, op2) {
+		return NullOperator(op, op1, op2)
+	}
+	if op == ":" {
+		return ColonOperator(op1, op2)
+	}
+	return arithmeticAndRelationalOperator(ctx, op, op1, op2)
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("Could not get operands for %v", op)
+// Parse the Strings of v, a value or a list, as DateTimes with the layouts
+// and time zone of env. Other values are returned unchanged.
+func parseDateTimes(env *Env, v datatype.DataType) (datatype.DataType, error) {
+	switch v := v.(type) {
+	case datatype.String:
+		return env.ParseDateTime(string(v))
+	case datatype.List:
+		l := make(datatype.List, len(v))
+		for i, item := range v {
+			d, err := parseDateTimes(env, item)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = d
+		}
+		return l, nil
+	}
+	return v, nil
+}
+
+// Whether a and b are equal as with the = operator, eg. 1.5M and 1.50M or 1
+// and 1.0. Lists and Maps are equal if they have equal items. Values that =
+// can't compare, eg. a String and an Int, are not equal.
+func valuesEqual(a, b datatype.DataType) bool {
+	switch va := a.(type) {
+	case datatype.List:
+		vb, ok := b.(datatype.List)
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !valuesEqual(va[i], vb[i]) {
+				return false
+			}
+		}
+		return true
+	case datatype.Map:
+		vb, ok := b.(datatype.Map)
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for k, v := range va {
+			if w, ok := vb[k]; !ok || !valuesEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+
+	res, err := BinaryOperator(tokenizer.RelationalOperatorEqualTo, a, b)
+	eq, ok := res.(datatype.Bool)
+	return err == nil && ok && bool(eq)
+}
+
+// Whether the list has an item equal to v
+func containsValue(l datatype.List, v datatype.DataType) bool {
+	for _, item := range l {
+		if valuesEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Null coalescing operator - the first operand unless it is null
+func CoalesceOperator(op1, op2 datatype.DataType) (datatype.DataType, error) {
+	if datatype.IsNull(op1) {
+		return op2, nil
+	}
+	return op1, nil
+}
+
+// Binary operators where at least one operand is null. Null is only equal to
+// null, all other operations give null.
+func NullOperator(op string, op1, op2 datatype.DataType) (datatype.DataType, error) {
+	switch op {
+	case tokenizer.RelationalOperatorEqualTo:
+		return datatype.Bool(datatype.IsNull(op1, op2)), nil
+	case tokenizer.RelationalOperatorNotEqualTo:
+		return datatype.Bool(!datatype.IsNull(op1, op2)), nil
+	}
+	return datatype.Null{}, nil
+}
+
+// Arithmetic and relational operators. Operations on two Ints give an Int. If
+// either operand is a Decimal, both are converted to Decimals, otherwise if
+// either is a Double, both are converted to Doubles.
+func ArithmeticAndRelationalOperator(op string, op1, op2 datatype.DataType) (datatype.DataType, error) {
+	return arithmeticAndRelationalOperator(datatype.DefaultDecimalContext(), op, op1, op2)
+}
+
+func arithmeticAndRelationalOperator(ctx datatype.DecimalContext, op string, op1, op2 datatype.DataType) (datatype.DataType, error) {
+	if datatype.IsNumber(op1, op2) && datatype.IsDecimalAny(op1, op2) {
+		mop1, err := datatype.ToDecimal(op1)
+		if err != nil {
+			return nil, err
+		}
+		mop2, err := datatype.ToDecimal(op2)
+		if err != nil {
+			return nil, err
+		}
+		return decimalOperator(ctx, op, mop1, mop2)
+	}
+
+	if iop1, ok := op1.(datatype.Int); ok {
+		if iop2, ok := op2.(datatype.Int); ok {
+			return IntOperator(op, iop1, iop2)
+		}
+	}
+
+	if datatype.IsTimeAny(op1, op2) && !datatype.IsListAny(op1, op2) {
+		return TimeOperator(op, op1, op2)
 	}
 
 	isString := datatype.IsString(op1, op2)
 	isNumber := datatype.IsNumber(op1, op2)
-	isDateTime := datatype.IsDateTime(op1, op2)
-	isDateTimeInt := datatype.IsDateTime(op1) && datatype.IsInt(op2)
 	isListAny := datatype.IsListAny(op1, op2)
 	isListAll := datatype.IsListAll(op1, op2)
 	isListFirst := datatype.IsListAny(op1)
+	isMap := datatype.IsMap(op1, op2)
 
 	sop1, sop2, _ := datatype.UpgradeBinaryOperandsToStrings(op1, op2)
 	dop1, dop2, _ := datatype.UpgradeBinaryOperandsToDoubles(op1, op2)
 	lop1, lop2, _ := datatype.UpgradeBinaryOperandsToLists(op1, op2)
 
-	lop2Items := map[datatype.DataType]bool{}
-
-	if isListFirst {
-		for _, item := range lop2 {
-			lop2Items[item] = true
-		}
-	}
-
-	badDataErr := fmt.Errorf("Cannot perform operation '%s' on %v and %v", op.TokenText(), op1.DataType(), op2.DataType())
-
-	switch opv := op.TokenText(); opv {
+	switch op {
 	case tokenizer.ArithmeticOperatorPlus:
 		if isNumber {
 			return dop1 + dop2, nil
@@ -250,11 +452,6 @@ func ArithmeticAndRelationalOperator(pfe *PostfixExpression, op tokenizer.Operat
 		if isListAny && lop1.DataType() == lop2.DataType() {
 			return append(lop1, lop2...), nil
 		}
-		if isDateTimeInt {
-			dt, d := op1.(datatype.DateTime), op2.(datatype.Int)
-			res := time.Time(dt).Add(time.Duration(d) * time.Hour * 24)
-			return datatype.DateTime(res), nil
-		}
 
 	case tokenizer.ArithmeticOperatorMinus:
 		if isNumber {
@@ -263,22 +460,12 @@ func ArithmeticAndRelationalOperator(pfe *PostfixExpression, op tokenizer.Operat
 		if isListFirst && lop1.DataType() == lop2.DataType() {
 			var res datatype.List
 			for _, item := range lop1 {
-				if !lop2Items[item] {
+				if !containsValue(lop2, item) {
 					res = append(res, item)
 				}
 			}
 			return res, nil
 		}
-		if isDateTime {
-			dt1, dt2 := op1.(datatype.DateTime), op2.(datatype.DateTime)
-			d := int(time.Time(dt1).Sub(time.Time(dt2)) / (24 * time.Hour))
-			return datatype.Int(d), nil
-		}
-		if isDateTimeInt {
-			dt, d := op1.(datatype.DateTime), op2.(datatype.Int)
-			res := time.Time(dt).Add(-time.Duration(d) * time.Hour * 24)
-			return datatype.DateTime(res), nil
-		}
 
 	case tokenizer.ArithmeticOperatorMultiply:
 		if isNumber {
@@ -296,7 +483,7 @@ func ArithmeticAndRelationalOperator(pfe *PostfixExpression, op tokenizer.Operat
 		if isListAll && lop1.DataType() == lop2.DataType() {
 			var res datatype.List
 			for _, item := range lop1 {
-				if lop2Items[item] {
+				if containsValue(lop2, item) {
 					res = append(res, item)
 				}
 			}
@@ -311,7 +498,10 @@ func ArithmeticAndRelationalOperator(pfe *PostfixExpression, op tokenizer.Operat
 			return datatype.Bool(sop1 == sop2), nil
 		}
 		if isListAll && lop1.DataType() == lop2.DataType() {
-			return datatype.Bool(reflect.DeepEqual(lop1, lop2)), nil
+			return datatype.Bool(valuesEqual(lop1, lop2)), nil
+		}
+		if isMap {
+			return datatype.Bool(valuesEqual(op1, op2)), nil
 		}
 	case tokenizer.RelationalOperatorNotEqualTo:
 		if isNumber {
@@ -321,7 +511,10 @@ func ArithmeticAndRelationalOperator(pfe *PostfixExpression, op tokenizer.Operat
 			return datatype.Bool(sop1 != sop2), nil
 		}
 		if isListAll && lop1.DataType() == lop2.DataType() {
-			return datatype.Bool(!reflect.DeepEqual(lop1, lop2)), nil
+			return datatype.Bool(!valuesEqual(lop1, lop2)), nil
+		}
+		if isMap {
+			return datatype.Bool(!valuesEqual(op1, op2)), nil
 		}
 	case tokenizer.RelationalOperatorGreater:
 		if isNumber {
@@ -353,55 +546,432 @@ func ArithmeticAndRelationalOperator(pfe *PostfixExpression, op tokenizer.Operat
 		}
 
 	default:
-		return nil, fmt.Errorf("Unsupported arithmetic or relational operator '%s'", opv)
+		return nil, fmt.Errorf("Unsupported arithmetic or relational operator '%s'", op)
 
 	}
-	return nil, badDataErr
+	return nil, operandsMismatch(op, op1, op2)
 }
 
-func LogicalOperator(pfe *PostfixExpression, op tokenizer.Operator) (datatype.DataType, error) {
-	if op.TokenText()[0] == '!' {
-		op1, err := GetUnaryOperand(pfe)
-		if err != nil {
-			return nil, fmt.Errorf("Could not get operands for %v", op)
+// Arithmetic and relational operators on Ints. Arithmetic returns an error
+// if the result overflows. Division truncates towards zero and the result of
+// a modulo has the sign of the dividend, eg. -7 / 2 = -3 and -7 # 2 = -1.
+func IntOperator(op string, op1, op2 datatype.Int) (datatype.DataType, error) {
+	overflow := func() error {
+		return &OverflowError{Op: op, Operands: []datatype.DataType{op1, op2}, Type: datatype.DataTypeInt}
+	}
+	divisionByZero := func() error {
+		return &DivisionByZeroError{Op: op, Operands: []datatype.DataType{op1, op2}}
+	}
+
+	switch op {
+	case tokenizer.ArithmeticOperatorPlus:
+		res := op1 + op2
+		if (op1 > 0 && op2 > 0 && res < 0) || (op1 < 0 && op2 < 0 && res >= 0) {
+			return nil, overflow()
+		}
+		return res, nil
+	case tokenizer.ArithmeticOperatorMinus:
+		res := op1 - op2
+		if (op1 >= 0 && op2 < 0 && res < 0) || (op1 < 0 && op2 > 0 && res >= 0) {
+			return nil, overflow()
+		}
+		return res, nil
+	case tokenizer.ArithmeticOperatorMultiply:
+		res := op1 * op2
+		if op1 != 0 && (res/op1 != op2 || (op1 == -1 && op2 == math.MinInt)) {
+			return nil, overflow()
+		}
+		return res, nil
+	case tokenizer.ArithmeticOperatorDivide:
+		if op2 == 0 {
+			return nil, divisionByZero()
+		}
+		if op1 == math.MinInt && op2 == -1 {
+			return nil, overflow()
+		}
+		return op1 / op2, nil
+	case tokenizer.ArithmeticOperatorModulo:
+		if op2 == 0 {
+			return nil, divisionByZero()
+		}
+		return op1 % op2, nil
+
+	case tokenizer.RelationalOperatorEqualTo:
+		return datatype.Bool(op1 == op2), nil
+	case tokenizer.RelationalOperatorNotEqualTo:
+		return datatype.Bool(op1 != op2), nil
+	case tokenizer.RelationalOperatorGreater:
+		return datatype.Bool(op1 > op2), nil
+	case tokenizer.RelationalOperatorLesser:
+		return datatype.Bool(op1 < op2), nil
+	case tokenizer.RelationalOperatorGreaterOrEqualTo:
+		return datatype.Bool(op1 >= op2), nil
+	case tokenizer.RelationalOperatorLesserOrEqualTo:
+		return datatype.Bool(op1 <= op2), nil
+	}
+
+	return nil, operandsMismatch(op, op1, op2)
+}
+
+// Arithmetic and relational operators on DateTimes and Durations:
+//
+//	DateTime ± Duration, Duration + DateTime -> DateTime
+//	DateTime ± Int -> DateTime, the Int is a number of days
+//	DateTime - DateTime -> Duration
+//	Duration ± Duration -> Duration
+//	Duration * Number, Number * Duration, Duration / Number -> Duration
+//	Duration / Duration -> Double
+//
+// DateTime arithmetic uses wall clock time in the time zone of the DateTime,
+// so daylight saving time changes don't shift the time of day: a DateTime
+// plus 1 day or 24h has the same time of day, and from midnight to midnight
+// of the next day is 24h. The second operand of DateTime - DateTime is
+// converted to the time zone of the first. DateTimes and Durations can also
+// be compared with each other, DateTimes by the instant they stand for.
+func TimeOperator(op string, op1, op2 datatype.DataType) (datatype.DataType, error) {
+	overflow := func() error {
+		return &OverflowError{Op: op, Operands: []datatype.DataType{op1, op2}, Type: datatype.DataTypeDuration}
+	}
+	divisionByZero := func() error {
+		return &DivisionByZeroError{Op: op, Operands: []datatype.DataType{op1, op2}}
+	}
+
+	switch v1 := op1.(type) {
+	case datatype.DateTime:
+		switch v2 := op2.(type) {
+		case datatype.DateTime:
+			if op == tokenizer.ArithmeticOperatorMinus {
+				d := v1.Sub(v2)
+				// Sub saturates instead of overflowing
+				if d == math.MaxInt64 || d == math.MinInt64 {
+					return nil, overflow()
+				}
+				return datatype.Duration(d), nil
+			}
+			c := time.Time(v1).Compare(time.Time(v2))
+			if res, ok := compareResult(op, c); ok {
+				return res, nil
+			}
+		case datatype.Int:
+			days := int(v2)
+			switch op {
+			case tokenizer.ArithmeticOperatorMinus:
+				days = -days
+				fallthrough
+			case tokenizer.ArithmeticOperatorPlus:
+				res, err := v1.Add(days, datatype.UnitDay)
+				if err != nil {
+					return nil, &OverflowError{Op: op, Operands: []datatype.DataType{op1, op2}, Type: datatype.DataTypeDateTime}
+				}
+				return res, nil
+			}
+		case datatype.Duration:
+			d := time.Duration(v2)
+			switch op {
+			case tokenizer.ArithmeticOperatorPlus:
+				return v1.AddDuration(d), nil
+			case tokenizer.ArithmeticOperatorMinus:
+				if d == math.MinInt64 {
+					return nil, overflow()
+				}
+				return v1.AddDuration(-d), nil
+			}
 		}
 
-		if !datatype.IsBool(op1) {
-			return nil, fmt.Errorf("Cannot perform operation '%s' on %v", op.TokenText(), op1.DataType())
+	case datatype.Duration:
+		d1 := time.Duration(v1)
+		switch v2 := op2.(type) {
+		case datatype.Duration:
+			d2 := time.Duration(v2)
+			switch op {
+			case tokenizer.ArithmeticOperatorPlus:
+				res := d1 + d2
+				if (d1 > 0 && d2 > 0 && res < 0) || (d1 < 0 && d2 < 0 && res >= 0) {
+					return nil, overflow()
+				}
+				return datatype.Duration(res), nil
+			case tokenizer.ArithmeticOperatorMinus:
+				res := d1 - d2
+				if (d1 >= 0 && d2 < 0 && res < 0) || (d1 < 0 && d2 > 0 && res >= 0) {
+					return nil, overflow()
+				}
+				return datatype.Duration(res), nil
+			case tokenizer.ArithmeticOperatorDivide:
+				if d2 == 0 {
+					return nil, divisionByZero()
+				}
+				return datatype.Double(float64(d1) / float64(d2)), nil
+			}
+			c := 0
+			if d1 < d2 {
+				c = -1
+			} else if d1 > d2 {
+				c = 1
+			}
+			if res, ok := compareResult(op, c); ok {
+				return res, nil
+			}
+		case datatype.DateTime:
+			if op == tokenizer.ArithmeticOperatorPlus {
+				return v2.AddDuration(d1), nil
+			}
+		default:
+			if datatype.IsNumber(v2) && (op == tokenizer.ArithmeticOperatorMultiply || op == tokenizer.ArithmeticOperatorDivide) {
+				f, err := datatype.ToDouble(v2)
+				if err != nil {
+					return nil, err
+				}
+				res := float64(d1)
+				if op == tokenizer.ArithmeticOperatorMultiply {
+					res *= float64(f)
+				} else {
+					if f == 0 {
+						return nil, divisionByZero()
+					}
+					res /= float64(f)
+				}
+				if math.IsNaN(res) || res >= math.MaxInt64 || res < math.MinInt64 {
+					return nil, overflow()
+				}
+				return datatype.Duration(math.Round(res)), nil
+			}
 		}
 
-		bop1, _ := op1.(datatype.Bool)
-		return datatype.Bool(!bop1), nil
+	default:
+		// Number * Duration
+		if d, ok := op2.(datatype.Duration); ok && datatype.IsNumber(op1) && op == tokenizer.ArithmeticOperatorMultiply {
+			return TimeOperator(op, d, op1)
+		}
 	}
 
-	op1, op2, err := GetBinaryOperands(pfe)
+	return nil, operandsMismatch(op, op1, op2)
+}
+
+// The result of a relational operator for the result c of comparing two
+// values, or false if op isn't a relational operator
+func compareResult(op string, c int) (datatype.DataType, bool) {
+	switch op {
+	case tokenizer.RelationalOperatorEqualTo:
+		return datatype.Bool(c == 0), true
+	case tokenizer.RelationalOperatorNotEqualTo:
+		return datatype.Bool(c != 0), true
+	case tokenizer.RelationalOperatorGreater:
+		return datatype.Bool(c > 0), true
+	case tokenizer.RelationalOperatorLesser:
+		return datatype.Bool(c < 0), true
+	case tokenizer.RelationalOperatorGreaterOrEqualTo:
+		return datatype.Bool(c >= 0), true
+	case tokenizer.RelationalOperatorLesserOrEqualTo:
+		return datatype.Bool(c <= 0), true
+	}
+	return nil, false
+}
+
+// Arithmetic and relational operators on Decimals. Only division can't be
+// exact, it is rounded as set by datatype.DefaultDecimalContext(). Arithmetic
+// returns an error if the result is out of the range of Decimals.
+func DecimalOperator(op string, op1, op2 datatype.Decimal) (datatype.DataType, error) {
+	return decimalOperator(datatype.DefaultDecimalContext(), op, op1, op2)
+}
+
+// Decimal operators that divide as set by ctx
+func decimalOperator(ctx datatype.DecimalContext, op string, op1, op2 datatype.Decimal) (datatype.DataType, error) {
+	var res datatype.Decimal
+	var err error
+
+	switch op {
+	case tokenizer.ArithmeticOperatorPlus:
+		res = op1.Add(op2)
+	case tokenizer.ArithmeticOperatorMinus:
+		res = op1.Sub(op2)
+	case tokenizer.ArithmeticOperatorMultiply:
+		res = op1.Mul(op2)
+	case tokenizer.ArithmeticOperatorDivide:
+		res, err = op1.Quo(op2, ctx.DivisionScale, ctx.Rounding)
+		// Don't pad exact results like 10 / 4 = 2.5 with zeros
+		minScale := op1.Scale()
+		if op2.Scale() > minScale {
+			minScale = op2.Scale()
+		}
+		res = res.Trim(minScale)
+	case tokenizer.ArithmeticOperatorModulo:
+		res, err = op1.Rem(op2)
+
+	case tokenizer.RelationalOperatorEqualTo:
+		return datatype.Bool(op1.Cmp(op2) == 0), nil
+	case tokenizer.RelationalOperatorNotEqualTo:
+		return datatype.Bool(op1.Cmp(op2) != 0), nil
+	case tokenizer.RelationalOperatorGreater:
+		return datatype.Bool(op1.Cmp(op2) > 0), nil
+	case tokenizer.RelationalOperatorLesser:
+		return datatype.Bool(op1.Cmp(op2) < 0), nil
+	case tokenizer.RelationalOperatorGreaterOrEqualTo:
+		return datatype.Bool(op1.Cmp(op2) >= 0), nil
+	case tokenizer.RelationalOperatorLesserOrEqualTo:
+		return datatype.Bool(op1.Cmp(op2) <= 0), nil
+	default:
+		return nil, operandsMismatch(op, op1, op2)
+	}
 
+	if err == nil {
+		err = res.CheckRange()
+	}
 	if err != nil {
-		return nil, fmt.Errorf("Could not get operands for %v", op)
+		return nil, decimalError(err, op, op1, op2)
 	}
+	return res, nil
+}
 
+// The typed error for an error of a Decimal operation
+func decimalError(err error, op string, op1, op2 datatype.Decimal) error {
+	switch {
+	case errors.Is(err, datatype.ErrDivisionByZero):
+		return &DivisionByZeroError{Op: op, Operands: []datatype.DataType{op1, op2}}
+	case errors.Is(err, datatype.ErrDecimalRange):
+		return &OverflowError{Op: op, Operands: []datatype.DataType{op1, op2}, Type: datatype.DataTypeDecimal}
+	}
+	return err
+}
+
+func LogicalNotOperator(op1 datatype.DataType) (datatype.DataType, error) {
+	if datatype.IsNull(op1) {
+		return op1, nil
+	}
+	if !datatype.IsBool(op1) {
+		return nil, operandsMismatch("!", op1)
+	}
+
+	bop1, _ := op1.(datatype.Bool)
+	return datatype.Bool(!bop1), nil
+}
+
+// Logical and/or. Null is an unknown Bool, so the result is null unless the
+// other operand decides it, eg. null || true is true but null || false is
+// null.
+func LogicalOperator(op string, op1, op2 datatype.DataType) (datatype.DataType, error) {
+	if datatype.IsNullAny(op1, op2) {
+		return nullLogicalOperator(op, op1, op2)
+	}
 	if !datatype.IsBool(op1, op2) {
-		return nil, fmt.Errorf("Cannot perform operation '%s' on %v and %v", op.TokenText(), op1.DataType(), op2.DataType())
+		return nil, operandsMismatch(op, op1, op2)
 	}
 
 	// It's already known that these are booleans
 	bop1, _ := op1.(datatype.Bool)
 	bop2, _ := op2.(datatype.Bool)
 
-	switch opv := op.TokenText(); opv[0] {
+	switch op[0] {
 	case '&':
 		return datatype.Bool(bop1 && bop2), nil
 	case '|':
 		return datatype.Bool(bop1 || bop2), nil
 	default:
-		return nil, fmt.Errorf("Unsupported logical operator '%s'", opv)
+		return nil, fmt.Errorf("Unsupported logical operator '%s'", op)
+	}
+}
+
+func nullLogicalOperator(op string, op1, op2 datatype.DataType) (datatype.DataType, error) {
+	// The value that decides the result on its own
+	var decisive datatype.Bool
+	switch op[0] {
+	case '&':
+		decisive = false
+	case '|':
+		decisive = true
+	default:
+		return nil, fmt.Errorf("Unsupported logical operator '%s'", op)
+	}
+
+	for _, v := range []datatype.DataType{op1, op2} {
+		if !datatype.IsBool(v) && !datatype.IsNull(v) {
+			return nil, operandsMismatch(op, op1, op2)
+		}
+	}
+	if op1 == decisive || op2 == decisive {
+		return decisive, nil
 	}
+	return datatype.Null{}, nil
 }
 
-func IntrinsicMethodOperator(pfe *PostfixExpression, meth tokenizer.IntrinsicMethod) (datatype.DataType, error) {
-	im, err := GetIntrinsicMethod(meth.IntrinsicMethodName())
+func IntrinsicMethodOperator(fs *FunctionSet, name string, args []datatype.DataType) (datatype.DataType, error) {
+	env := *defaultEnv
+	env.Functions = fs
+	return callIntrinsicMethod(&env, name, args)
+}
+
+// Call an intrinsic method of env's function set. Methods that depend on the
+// environment, eg. on its clock, get env.
+func callIntrinsicMethod(env *Env, name string, args []datatype.DataType) (datatype.DataType, error) {
+	im, err := env.functions().lookup(name)
 	if err != nil {
 		return nil, err
 	}
-	return im.ExecuteMethod(pfe)
+
+	if em, ok := im.(envMethod); ok {
+		im = em(env)
+	}
+	v, err := im.ExecuteMethod(args...)
+	if ae, ok := err.(*ArgumentError); ok && ae.Method == "" {
+		ae.Method = name
+	}
+	return v, err
+}
+
+// Type cast operator - convert a value or all items of a list to a data type.
+// Null stays null.
+func TypeCastOperator(dataType string, valToCast datatype.DataType) (datatype.DataType, error) {
+	var c datatype.DataType
+	var err error
+
+	if datatype.IsNull(valToCast) {
+		return valToCast, nil
+	}
+
+	if l, isList := valToCast.(datatype.List); isList {
+		switch dataType {
+		case datatype.DataTypeString:
+			c, err = l.AllToString()
+		case datatype.DataTypeBool:
+			c, err = l.AllToBool()
+		case datatype.DataTypeDouble:
+			c, err = l.AllToDouble()
+		case datatype.DataTypeDecimal:
+			c, err = l.AllToDecimal()
+		case datatype.DataTypeChar:
+			c, err = l.AllToChar()
+		case datatype.DataTypeInt:
+			c, err = l.AllToInt()
+		case datatype.DataTypeDateTime:
+			c, err = l.AllToDateTime()
+		default:
+			return nil, typeMismatch("cast", l, "Cannot convert a list to %s", dataType)
+		}
+	} else {
+		switch dataType {
+		case datatype.DataTypeString:
+			c, err = datatype.ToString(valToCast)
+		case datatype.DataTypeBool:
+			c, err = datatype.ToBool(valToCast)
+		case datatype.DataTypeDouble:
+			c, err = datatype.ToDouble(valToCast)
+		case datatype.DataTypeDecimal:
+			c, err = datatype.ToDecimal(valToCast)
+		case datatype.DataTypeChar:
+			c, err = datatype.ToChar(valToCast)
+		case datatype.DataTypeInt:
+			c, err = datatype.ToInt(valToCast)
+		case datatype.DataTypeDateTime:
+			c, err = datatype.ToDateTime(valToCast)
+		case datatype.DataTypeDuration:
+			c, err = datatype.ToDuration(valToCast)
+		default:
+			return nil, typeMismatch("cast", valToCast, "Cannot convert %s to %s", valToCast.DataType(), dataType)
+		}
+	}
+
+	if err == nil {
+		return c, nil
+	} else {
+		return nil, err
+	}
 }
@@ -0,0 +1,48 @@
+package evaluator
+
+import (
+	"github.com/contactkeval/expressioneval/ast"
+	"github.com/contactkeval/expressioneval/datatype"
+	"github.com/contactkeval/expressioneval/parser"
+	"github.com/contactkeval/expressioneval/tokenizer"
+)
+
+// A compiled expression. The expression is tokenized and parsed once by
+// Compile and can then be evaluated any number of times. A Program is never
+// modified after it is compiled, so Eval can be called from many goroutines
+// at the same time.
+type Program struct {
+	text string
+	root ast.Node
+}
+
+// Compile tokenizes and parses an expression
+func Compile(text string) (*Program, error) {
+	tokens, err := tokenizer.Tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := parser.Parse(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Program{text: text, root: root}, nil
+}
+
+// Eval evaluates the program in env. If env is nil, symbols are looked up in
+// the global SymbolTable.
+func (p *Program) Eval(env *Env) (datatype.DataType, error) {
+	return EvaluateNode(p.root, env)
+}
+
+// The syntax tree of the program
+func (p *Program) AST() ast.Node {
+	return p.root
+}
+
+// The text the program was compiled from
+func (p *Program) String() string {
+	return p.text
+}
@@ -0,0 +1,135 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/contactkeval/expressioneval/datatype"
+	"github.com/contactkeval/expressioneval/tokenizer"
+)
+
+const benchExpression = `MyInt * 2 + Length(MyString) > 10 && StartsWith("Mr. John Smith", ["Miss.", "Mrs.", "Mr."])`
+
+func BenchmarkCompileEval(b *testing.B) {
+	p, err := Compile(benchExpression)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Eval(nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTokenizeEvaluate(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		tokens, err := tokenizer.Tokenize(benchExpression)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := Evaluate(tokens); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Run with -race. Each goroutine evaluates the same programs with its own
+// symbols and checks that it gets its own results.
+func TestProgramEvalConcurrent(t *testing.T) {
+	programs := []string{
+		`x * 2 + 1`,
+		`x > 50 ? "big" : "small"`,
+		`Max([x, 10, MyInt])`,
+		`ToString(x) + "A"`,
+	}
+	compiled := make([]*Program, len(programs))
+	for i, text := range programs {
+		p, err := Compile(text)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", text, err)
+		}
+		compiled[i] = p
+	}
+
+	expected := func(x int) []string {
+		size := "small"
+		if x > 50 {
+			size = "big"
+		}
+		max := 100
+		if x > max {
+			max = x
+		}
+		return []string{fmt.Sprint(x*2 + 1), size, fmt.Sprint(max), fmt.Sprint(x) + "A"}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for x := g; x < g+200; x += 3 {
+				env := NewEnv(NewScope(GlobalSymbols, map[string]interface{}{"x": datatype.Int(x)}))
+				want := expected(x)
+				for i, p := range compiled {
+					v, err := p.Eval(env)
+					if err != nil {
+						errs <- fmt.Errorf("%s with x=%d: %v", p, x, err)
+						return
+					}
+					if got := datatype.ToPrint(v); got != want[i] {
+						errs <- fmt.Errorf("%s with x=%d: got %s, want %s", p, x, got, want[i])
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// Run with -race. Environments with different decimal contexts can evaluate
+// at the same time.
+func TestProgramEvalConcurrentDecimalContexts(t *testing.T) {
+	p, err := Compile(`2M / 3M`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(scale int) {
+			defer wg.Done()
+			env := NewEnv(GlobalSymbols)
+			env.DecimalContext = &datatype.DecimalContext{DivisionScale: scale, Rounding: datatype.RoundDown}
+			want := "0." + strings.Repeat("6", scale)
+			for i := 0; i < 100; i++ {
+				v, err := p.Eval(env)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if got := datatype.ToPrint(v); got != want {
+					errs <- fmt.Errorf("scale %d: got %s, want %s", scale, got, want)
+					return
+				}
+			}
+		}(g + 1)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
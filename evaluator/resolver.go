@@ -0,0 +1,143 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/contactkeval/expressioneval/datatype"
+)
+
+// A Resolver supplies the values of the symbols referenced by an expression.
+// Resolve returns false if the resolver does not know the symbol, and an
+// error if it knows the symbol but could not produce its value.
+type Resolver interface {
+	Resolve(name string) (datatype.DataType, bool, error)
+}
+
+// Resolver backed by a map. Values that are not a datatype.DataType are
+// converted with datatype.FromValue. A dotted name that isn't in the map is a
+// member of a shorter name, eg. Config.Rate is the Rate member of Config if
+// there is no symbol Config.Rate. Members of Go structs and maps are looked up
+// without converting the rest of the value.
+type MapResolver map[string]interface{}
+
+func (m MapResolver) Resolve(name string) (datatype.DataType, bool, error) {
+	symVal, found, err := m.value(name)
+	if !found || err != nil {
+		return nil, found, err
+	}
+
+	v, err := datatype.FromValue(symVal)
+	if err != nil {
+		return nil, true, fmt.Errorf("Could not find symbol %s (value unexpected): %v", name, err)
+	}
+	return v, true, nil
+}
+
+// The value of a symbol, which is either a Go value or a data type
+func (m MapResolver) value(name string) (interface{}, bool, error) {
+	if symVal, exists := m[name]; exists {
+		return symVal, true, nil
+	}
+
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return nil, false, nil
+	}
+
+	parent, found, err := m.value(name[:i])
+	if !found || err != nil {
+		return nil, found, err
+	}
+	if v, ok := datatype.GoMember(parent, name[i+1:]); ok {
+		return v, true, nil
+	}
+
+	v, err := datatype.FromValue(parent)
+	if err != nil {
+		return nil, true, fmt.Errorf("Could not find symbol %s (value unexpected): %v", name[:i], err)
+	}
+	if _, ok := v.(datatype.MemberAccessor); !ok && !datatype.IsNull(v) {
+		return nil, false, nil
+	}
+
+	v, err = MemberOperator(v, name[i+1:])
+	if err != nil {
+		return nil, true, fmt.Errorf("Could not resolve symbol %s: %v", name, err)
+	}
+	return v, true, nil
+}
+
+// Resolver backed by a function, for symbols that are computed or looked up
+// on demand
+type FuncResolver func(name string) (datatype.DataType, bool, error)
+
+func (f FuncResolver) Resolve(name string) (datatype.DataType, bool, error) {
+	return f(name)
+}
+
+// A list of resolvers that are tried in order. The first resolver that knows
+// the symbol determines its value, so earlier resolvers shadow later ones.
+type ChainResolver []Resolver
+
+func (c ChainResolver) Resolve(name string) (datatype.DataType, bool, error) {
+	for _, r := range c {
+		if r == nil {
+			continue
+		}
+		if v, found, err := r.Resolve(name); found || err != nil {
+			return v, found, err
+		}
+	}
+	return nil, false, nil
+}
+
+// NewScope creates a scope with its own symbols that falls back to parent for
+// any symbol it does not define
+func NewScope(parent Resolver, symbols map[string]interface{}) Resolver {
+	return ChainResolver{MapResolver(symbols), parent}
+}
+
+// The global SymbolTable as a resolver. Use it as the parent of a scope to
+// make the predefined symbols available to an expression.
+var GlobalSymbols Resolver = MapResolver(SymbolTable)
+
+// Resolver that exposes a Go value to expressions. The value must be a struct
+// or a map with string keys. Dotted symbol names are resolved by following the
+// members of the value, so the symbol Order.Customer.Name is the Name field of
+// the Customer field of the Order field. See datatype.FromValue for how Go
+// values are converted.
+type ValueResolver struct {
+	root datatype.MemberAccessor
+}
+
+// NewValueResolver creates a resolver for the members of v
+func NewValueResolver(v interface{}) (*ValueResolver, error) {
+	d, err := datatype.FromValue(v)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := d.(datatype.MemberAccessor)
+	if !ok {
+		return nil, fmt.Errorf("Symbols can only be bound to a struct or map instead of %s", d.DataType())
+	}
+	return &ValueResolver{root: root}, nil
+}
+
+func (r *ValueResolver) Resolve(name string) (datatype.DataType, bool, error) {
+	parts := strings.Split(name, ".")
+
+	v, found, err := r.root.Member(parts[0])
+	if !found || err != nil {
+		return nil, found, err
+	}
+
+	for _, part := range parts[1:] {
+		v, err = MemberOperator(v, part)
+		if err != nil {
+			return nil, true, fmt.Errorf("Could not resolve symbol %s: %v", name, err)
+		}
+	}
+
+	return v, true, nil
+}
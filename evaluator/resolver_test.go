@@ -0,0 +1,267 @@
+package evaluator
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/contactkeval/expressioneval/datatype"
+)
+
+// A name the value resolver doesn't know falls through to the next resolver,
+// and is an unknown symbol if no resolver knows it
+func TestValueResolverFallsThrough(t *testing.T) {
+	r, err := NewValueResolver(map[string]interface{}{
+		"Order": map[string]interface{}{"Total": 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnv(ChainResolver{r, GlobalSymbols})
+
+	tests := map[string]string{
+		"Order.Total":   "5",
+		"Order.Missing": "null",
+		"MyInt":         "100",
+	}
+	for text, want := range tests {
+		if got := evalPrintIn(env, text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+
+	for _, text := range []string{"Ordr.Total", "Ordr"} {
+		p, err := Compile(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = p.Eval(env)
+		var use *UnknownSymbolError
+		if !errors.As(err, &use) || use.Name != text {
+			t.Errorf("%s: error %v, want an UnknownSymbolError for %s", text, err, text)
+		}
+	}
+}
+
+func TestValueResolverStruct(t *testing.T) {
+	type Customer struct {
+		Name string `expr:",omitempty"`
+	}
+	type Order struct {
+		Customer
+		Total float64 `expr:"total"`
+	}
+	r, err := NewValueResolver(struct{ Order Order }{Order{Customer{"Ann"}, 2.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"Order.Name":  "Ann",
+		"Order.total": "2.5",
+	}
+	for text, want := range tests {
+		if got := evalPrintIn(NewEnv(r), text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+	if got := evalPrintIn(NewEnv(ChainResolver{r, MapResolver{"Other": datatype.Int(1)}}), "Other"); got != "1" {
+		t.Errorf("Other = %s, want 1", got)
+	}
+}
+
+func TestMapResolverMembers(t *testing.T) {
+	type Address struct{ City string }
+	type Customer struct {
+		Name    string
+		Address *Address
+	}
+	env := NewEnv(NewScope(GlobalSymbols, map[string]interface{}{
+		"Config":   datatype.Map{"Rate": datatype.Double(1.5), "Inner": datatype.Map{"X": datatype.Int(1)}},
+		"Customer": &Customer{Name: "Bob"},
+		"Options":  map[string]interface{}{"a": 1, "b": nil, "c": map[string]int{"d": 2}},
+	}))
+
+	tests := map[string]string{
+		"Config.Rate":           "1.5",
+		"Config.Inner.X":        "1",
+		"Config.Missing":        "null",
+		"Customer.Name":         "Bob",
+		"Customer.Address.City": "null",
+		"Customer.Missing":      "error: Could not resolve symbol Customer.Missing: Object has no member Missing at line 1, column 1",
+		"Options.a":             "1",
+		"Options.b":             "null",
+		"Options.b.c":           "null",
+		"Options.missing":       "null",
+		"Options.c.d":           "2",
+		"Options.a.b":           "error: Could not find symbol Options.a.b (name does not exist) at line 1, column 1",
+		"Math.PI > 3":           "true",
+	}
+	for text, want := range tests {
+		if got := evalPrintIn(env, text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+// Looking up a key of a Go map doesn't convert the whole map
+func TestMapResolverMemberDoesNotConvert(t *testing.T) {
+	big := map[string]interface{}{}
+	for i := 0; i < 1000; i++ {
+		big[strconv.Itoa(i)] = []int{i}
+	}
+	r := MapResolver{"Big": big}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		if v, found, err := r.Resolve("Big.500"); err != nil || !found || datatype.ToPrint(v) != "[500]" {
+			t.Fatalf("Big.500 = %v, %t, %v", v, found, err)
+		}
+	})
+	if allocs > 20 {
+		t.Errorf("looking up Big.500 made %.0f allocations", allocs)
+	}
+}
+
+// Each symbol is resolved once per evaluation
+func TestSymbolsResolvedOncePerEvaluation(t *testing.T) {
+	lookups := map[string]int{}
+	env := NewEnv(FuncResolver(func(name string) (datatype.DataType, bool, error) {
+		lookups[name]++
+		return datatype.Int(2), true, nil
+	}))
+
+	p, err := Compile("a * a + a - b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		if v, err := p.Eval(env); err != nil || v != datatype.Int(4) {
+			t.Errorf("a * a + a - b = %v, %v, want 4", v, err)
+		}
+		if lookups["a"] != i || lookups["b"] != i {
+			t.Errorf("resolved %v in %d evaluations", lookups, i)
+		}
+	}
+}
+
+// The result of resolving a name, as text
+func resolvePrint(r Resolver, name string) string {
+	v, found, err := r.Resolve(name)
+	switch {
+	case err != nil:
+		return "error: " + err.Error()
+	case !found:
+		return "not found"
+	}
+	return datatype.ToPrint(v)
+}
+
+func TestChainResolverOrder(t *testing.T) {
+	errBroken := errors.New("broken")
+	var calls []string
+	counting := func(id string, r Resolver) Resolver {
+		return FuncResolver(func(name string) (datatype.DataType, bool, error) {
+			calls = append(calls, id)
+			return r.Resolve(name)
+		})
+	}
+	chain := ChainResolver{
+		counting("first", MapResolver{"a": 1}),
+		nil,
+		counting("broken", FuncResolver(func(name string) (datatype.DataType, bool, error) {
+			if name == "bad" {
+				return nil, true, errBroken
+			}
+			return nil, false, nil
+		})),
+		counting("second", MapResolver{"a": 2, "b": 2, "bad": 2}),
+	}
+
+	tests := []struct {
+		name  string
+		want  string
+		calls string
+	}{
+		{"a", "1", "first"},
+		{"b", "2", "first broken second"},
+		{"bad", "error: broken", "first broken"},
+		{"c", "not found", "first broken second"},
+	}
+	for _, tt := range tests {
+		calls = nil
+		if got := resolvePrint(chain, tt.name); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, got, tt.want)
+		}
+		if got := strings.Join(calls, " "); got != tt.calls {
+			t.Errorf("%s: called %s, want %s", tt.name, got, tt.calls)
+		}
+	}
+
+	if got := resolvePrint(ChainResolver{}, "a"); got != "not found" {
+		t.Errorf("empty chain: a = %s, want not found", got)
+	}
+}
+
+func TestFuncResolver(t *testing.T) {
+	r := FuncResolver(func(name string) (datatype.DataType, bool, error) {
+		if n, err := strconv.Atoi(strings.TrimPrefix(name, "N")); err == nil && strings.HasPrefix(name, "N") {
+			return datatype.Int(n * 2), true, nil
+		}
+		return nil, false, nil
+	})
+	env := NewEnv(ChainResolver{r, GlobalSymbols})
+
+	tests := map[string]string{
+		"N21":       "42",
+		"N1 + N2":   "6",
+		"MyInt":     "100",
+		"Nope":      "error: Could not find symbol Nope (name does not exist) at line 1, column 1",
+		"N1 + Nope": "error: Could not find symbol Nope (name does not exist) at line 1, column 6",
+	}
+	for text, want := range tests {
+		if got := evalPrintIn(env, text); got != want {
+			t.Errorf("%s = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestMapResolverFallthrough(t *testing.T) {
+	m := MapResolver{
+		"Config":      map[string]interface{}{"Rate": 1.5, "Name": "base"},
+		"Config.Rate": 2.5,
+		"Count":       3,
+		"Nothing":     nil,
+	}
+
+	tests := map[string]string{
+		"Config.Rate":  "2.5",
+		"Config.Name":  "base",
+		"Config.Other": "null",
+		"Count":        "3",
+		"Count.Value":  "not found",
+		"Nothing.Name": "null",
+		"Missing":      "not found",
+		"Missing.Name": "not found",
+	}
+	for name, want := range tests {
+		if got := resolvePrint(m, name); got != want {
+			t.Errorf("%s = %s, want %s", name, got, want)
+		}
+	}
+
+	// Names the map doesn't know fall through to the parent of a scope, and
+	// names it knows shadow the parent
+	scope := NewScope(NewScope(GlobalSymbols, map[string]interface{}{"MyInt": 1, "Count": 7}), m)
+	scopeTests := map[string]string{
+		"MyInt":       "1",
+		"Count":       "3",
+		"Count.Value": "not found",
+		"MyDouble":    "400",
+	}
+	for name, want := range scopeTests {
+		if got := resolvePrint(scope, name); got != want {
+			t.Errorf("in scope: %s = %s, want %s", name, got, want)
+		}
+	}
+}
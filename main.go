@@ -1,8 +1,9 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	//	"path/filepath"
@@ -26,27 +27,59 @@ func main() {
 	*/
 }
 
+// Evaluate each line of a file as an expression. Lines that only have
+// comments are skipped. A /* */ comment can span several lines. The file is
+// scanned incrementally, so it can be of any size.
 func processFile(fileName string) {
 
-	if file, err := os.Open(fileName); err == nil {
+	file, err := os.Open(fileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
 
-		defer file.Close()
+	var line tokenizer.Tokens // Tokens of the current line
+	var lineErr error         // First syntax error in the current line
 
-		// create a new scanner and read the file line by line
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			fmt.Println(scanner.Text())
-			if len(strings.TrimSpace(scanner.Text())) > 0 && scanner.Text()[0:2] != "//" {
-				expressionEval(scanner.Text())
+	scanner := tokenizer.NewScanner(file)
+	for {
+		t, err := scanner.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var se *tokenizer.SyntaxError
+			if !errors.As(err, &se) {
+				log.Fatal(err)
+			}
+			// The scanner skips the bad character, so carry on with the line
+			if lineErr == nil {
+				lineErr = err
 			}
+			continue
 		}
 
-		if err = scanner.Err(); err != nil {
-			log.Fatal(err)
+		if _, ok := t.(tokenizer.Whitespace); ok && strings.Contains(t.TokenText(), "\n") {
+			processLine(line, lineErr)
+			line, lineErr = nil, nil
+			continue
 		}
+		line = append(line, t)
+	}
+	processLine(line, lineErr)
+}
 
-	} else {
-		log.Fatal(err)
+func processLine(tokens tokenizer.Tokens, err error) {
+	var text strings.Builder
+	for _, t := range tokens {
+		text.WriteString(t.TokenText())
+	}
+	fmt.Println(text.String())
+
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+	} else if len(tokens.WithoutTrivia()) > 0 {
+		evaluateTokens(tokens)
 	}
 }
 
@@ -55,14 +88,18 @@ func expressionEval(text string) {
 	if tokens, err := tokenizer.Tokenize(text); err != nil {
 		fmt.Printf("Tokens: %#v , Error: %#v\n", tokens, err)
 	} else {
-		tokens = tokens.WithoutWhitespace()
-
-		res, err := evaluator.Evaluate(tokens)
-		if err != nil {
-			fmt.Printf("ERROR: %v\n", err)
-		} else {
-			fmt.Printf("result => <%s> %s\n", res.DataType(), datatype.ToPrint(res))
-		}
+		evaluateTokens(tokens)
 	}
 
 }
+
+func evaluateTokens(tokens tokenizer.Tokens) {
+	tokens = tokens.WithoutTrivia()
+
+	res, err := evaluator.Evaluate(tokens)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+	} else {
+		fmt.Printf("result => <%s> %s\n", res.DataType(), datatype.ToPrint(res))
+	}
+}
@@ -0,0 +1,517 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/contactkeval/expressioneval/ast"
+	"github.com/contactkeval/expressioneval/datatype"
+	"github.com/contactkeval/expressioneval/tokenizer"
+)
+
+// The deepest the syntax tree of an expression can be. The parser and the
+// evaluator are recursive, so a deeper tree could overflow the stack.
+const MaxDepth = 10000
+
+// Parse builds the syntax tree for an expression from its tokens. Whitespace
+// and comment tokens are ignored. Errors are returned as a
+// *tokenizer.SyntaxError.
+func Parse(tokens tokenizer.Tokens) (ast.Node, error) {
+	p := &parser{tokens: tokens.WithoutTrivia()}
+
+	if p.atEnd() {
+		return nil, p.errorf(nil, "Invalid expression: expression is empty")
+	}
+
+	n, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.atEnd() {
+		return nil, p.errorf(p.peek(), "Unexpected token '%s'", p.peek().TokenText())
+	}
+
+	return n, nil
+}
+
+// Recursive descent parser. Binary operators are parsed by precedence climbing
+// using the precedences defined by the tokenizer.
+type parser struct {
+	tokens  tokenizer.Tokens
+	pos     int
+	lastEnd tokenizer.Position // End of the last consumed token
+	depth   int                // Depth in the syntax tree of the node being parsed
+}
+
+func (p *parser) atEnd() bool {
+	return p.pos >= len(p.tokens)
+}
+
+// The current token, or nil at the end of the expression
+func (p *parser) peek() tokenizer.Token {
+	if p.atEnd() {
+		return nil
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() tokenizer.Token {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+		p.lastEnd = t.Span().End
+	}
+	return t
+}
+
+// The position where the next node starts
+func (p *parser) start() tokenizer.Position {
+	if t := p.peek(); t != nil {
+		return t.Span().Start
+	}
+	return p.lastEnd
+}
+
+// The location of a node that started at start and ends with the last
+// consumed token
+func (p *parser) loc(start tokenizer.Position) ast.Loc {
+	return ast.Loc{Span: tokenizer.Span{Start: start, End: p.lastEnd}}
+}
+
+// Create a syntax error at token t, or at the end of the expression if t is nil
+func (p *parser) errorf(t tokenizer.Token, format string, args ...interface{}) error {
+	span := tokenizer.Span{Start: p.lastEnd, End: p.lastEnd}
+	if t != nil {
+		span = t.Span()
+	}
+	return tokenizer.SyntaxErrorf(span, format, args...)
+}
+
+// Go one level deeper into the syntax tree. The caller restores the depth with
+// a deferred call to setDepth when it returns.
+func (p *parser) descend() error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return p.errorf(p.peek(), "Expression is nested more than %d levels deep", MaxDepth)
+	}
+	return nil
+}
+
+func (p *parser) setDepth(depth int) {
+	p.depth = depth
+}
+
+// Check if the current token is the given open bracket
+func (p *parser) atOpenBracket(bracket string) bool {
+	b, ok := p.peek().(tokenizer.OpenBracket)
+	return ok && b.OpenBracket() == bracket
+}
+
+// Check if the current token is the close bracket matching bracket
+func (p *parser) atCloseBracket(bracket string) bool {
+	b, ok := p.peek().(tokenizer.CloseBracket)
+	return ok && b.CloseBracket() == bracket
+}
+
+// Consume the close bracket matching the open bracket
+func (p *parser) expectCloseBracket(bracket string) error {
+	t := p.next()
+	if b, ok := t.(tokenizer.CloseBracket); ok && b.CloseBracket() == bracket {
+		return nil
+	}
+	return p.errorf(t, "Expected bracket matching '%s' instead of %s", bracket, describe(t))
+}
+
+func (p *parser) expectComma() error {
+	t := p.next()
+	if _, ok := t.(tokenizer.Comma); ok {
+		return nil
+	}
+	return p.errorf(t, "Expected ',' instead of %s", describe(t))
+}
+
+func (p *parser) expectColon() error {
+	t := p.next()
+	if _, ok := t.(tokenizer.Colon); ok {
+		return nil
+	}
+	return p.errorf(t, "Expected ':' instead of %s", describe(t))
+}
+
+// expression := ternary [':' ternary]
+func (p *parser) parseExpression() (ast.Node, error) {
+	start := p.start()
+	left, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+
+	if t, ok := p.peek().(tokenizer.Colon); ok {
+		p.next()
+		right, err := p.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Binary{Loc: p.loc(start), Op: t.TokenText(), Left: left, Right: right}, nil
+	}
+
+	return left, nil
+}
+
+// ternary := binary ['?' ternary ':' ternary]
+//
+// The ternary operator is right associative, so a ? b : c ? d : e is parsed as
+// a ? b : (c ? d : e).
+func (p *parser) parseTernary() (ast.Node, error) {
+	defer p.setDepth(p.depth)
+	start := p.start()
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := p.peek().(tokenizer.Question); !ok {
+		return cond, nil
+	}
+	if err := p.descend(); err != nil {
+		return nil, err
+	}
+	p.next()
+
+	t, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectColon(); err != nil {
+		return nil, err
+	}
+	f, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.Conditional{Loc: p.loc(start), Cond: cond, True: t, False: f}, nil
+}
+
+// Parse a chain of binary operators with a precedence of at least minPrec
+func (p *parser) parseBinary(minPrec int) (ast.Node, error) {
+	defer p.setDepth(p.depth)
+	start := p.start()
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.peek().(tokenizer.Operator)
+		if !ok || isPrefixOnly(op) || op.Precedence() < minPrec {
+			return left, nil
+		}
+		// Each operator in a chain like a + b + c adds a level to the tree
+		if err := p.descend(); err != nil {
+			return nil, err
+		}
+		p.next()
+
+		// All binary operators are left associative
+		right, err := p.parseBinary(op.Precedence() + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &ast.Binary{Loc: p.loc(start), Op: op.TokenText(), Left: left, Right: right}
+	}
+}
+
+// unary := ('!' | '-' | '+' | typecast) unary | '?' legacyconditional | postfix
+func (p *parser) parseUnary() (ast.Node, error) {
+	defer p.setDepth(p.depth)
+	if err := p.descend(); err != nil {
+		return nil, err
+	}
+
+	start := p.start()
+
+	switch v := p.peek().(type) {
+	case tokenizer.Operator:
+		switch v.TokenText() {
+		case "!", tokenizer.ArithmeticOperatorMinus, tokenizer.ArithmeticOperatorPlus:
+			p.next()
+			operand, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return &ast.Unary{Loc: p.loc(start), Op: v.TokenText(), Operand: operand}, nil
+		}
+	case tokenizer.TypeCast:
+		p.next()
+		dt, err := v.CastDataType()
+		if err != nil {
+			return nil, err
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Cast{Loc: p.loc(start), DataType: dt, Operand: operand}, nil
+	case tokenizer.Question:
+		// A '?' in front of an operand is the legacy ?(cond : a, b) form
+		p.next()
+		return p.parseLegacyConditional(start)
+	}
+
+	return p.parsePostfix()
+}
+
+// legacyconditional := '(' binary ':' ternary ',' ternary ')'
+func (p *parser) parseLegacyConditional(start tokenizer.Position) (ast.Node, error) {
+	if !p.atOpenBracket(tokenizer.BracketParans) {
+		return nil, p.errorf(p.peek(), "Expected '(' after '?' instead of %s", describe(p.peek()))
+	}
+	p.next()
+
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectColon(); err != nil {
+		return nil, err
+	}
+	t, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectComma(); err != nil {
+		return nil, err
+	}
+	f, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectCloseBracket(tokenizer.BracketParans); err != nil {
+		return nil, err
+	}
+
+	return &ast.Conditional{Loc: p.loc(start), Cond: cond, True: t, False: f}, nil
+}
+
+// postfix := primary ('{' expression '}' | '.' name)*
+func (p *parser) parsePostfix() (ast.Node, error) {
+	defer p.setDepth(p.depth)
+	start := p.start()
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	// Each index and member adds a level to the tree
+	for {
+		if p.atOpenBracket(tokenizer.BracketCurly) {
+			if err := p.descend(); err != nil {
+				return nil, err
+			}
+			p.next()
+			idx, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectCloseBracket(tokenizer.BracketCurly); err != nil {
+				return nil, err
+			}
+			n = &ast.Index{Loc: p.loc(start), Target: n, Index: idx}
+		} else if _, ok := p.peek().(tokenizer.Dot); ok {
+			p.next()
+			names, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range names {
+				if err := p.descend(); err != nil {
+					return nil, err
+				}
+				n = &ast.Member{Loc: p.loc(start), Target: n, Name: name}
+			}
+		} else {
+			return n, nil
+		}
+	}
+}
+
+// Consume the name of a member. A dotted name is split into its parts.
+func (p *parser) expectName() ([]string, error) {
+	t := p.next()
+	switch t.(type) {
+	case tokenizer.Symbol, tokenizer.IntrinsicMethod:
+		return strings.Split(t.TokenText(), "."), nil
+	}
+	return nil, p.errorf(t, "Expected a member name after '.' instead of %s", describe(t))
+}
+
+// primary := literal | symbol | call | '(' expression ')' | '[' items ']' |
+// '@{' entries '}'
+func (p *parser) parsePrimary() (ast.Node, error) {
+	start := p.start()
+	t := p.next()
+
+	switch v := t.(type) {
+	case tokenizer.Literal:
+		d, err := literalValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Literal{Loc: p.loc(start), Value: d}, nil
+
+	case tokenizer.Symbol:
+		return &ast.Symbol{Loc: p.loc(start), Name: v.SymbolName()}, nil
+
+	case tokenizer.IntrinsicMethod:
+		if !p.atOpenBracket(tokenizer.BracketParans) {
+			return nil, p.errorf(p.peek(), "Expected '(' after method %s instead of %s", v.IntrinsicMethodName(), describe(p.peek()))
+		}
+		p.next()
+		args, err := p.parseItems(tokenizer.BracketParans)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Call{Loc: p.loc(start), Name: v.IntrinsicMethodName(), Args: args}, nil
+
+	case tokenizer.OpenBracket:
+		switch v.OpenBracket() {
+		case tokenizer.BracketParans:
+			n, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectCloseBracket(tokenizer.BracketParans); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case tokenizer.BracketSquare:
+			items, err := p.parseItems(tokenizer.BracketSquare)
+			if err != nil {
+				return nil, err
+			}
+			return &ast.List{Loc: p.loc(start), Items: items}, nil
+		case tokenizer.BracketMap:
+			return p.parseMap(start)
+		}
+	}
+
+	return nil, p.errorf(t, "Expected a value instead of %s", describe(t))
+}
+
+// Parse comma separated expressions up to the close bracket matching bracket.
+// The open bracket has already been consumed.
+func (p *parser) parseItems(bracket string) ([]ast.Node, error) {
+	var items []ast.Node
+
+	if p.atCloseBracket(bracket) {
+		p.next()
+		return items, nil
+	}
+
+	for {
+		item, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		if _, ok := p.peek().(tokenizer.Comma); !ok {
+			break
+		}
+		p.next()
+	}
+
+	if err := p.expectCloseBracket(bracket); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// entries := [entry (',' entry)*] '}'
+// entry := (string | name) ':' expression
+//
+// The '@{' has already been consumed.
+func (p *parser) parseMap(start tokenizer.Position) (ast.Node, error) {
+	m := &ast.Map{}
+	seen := map[string]bool{}
+
+	for !p.atCloseBracket(tokenizer.BracketCurly) {
+		if len(m.Keys) > 0 {
+			if err := p.expectComma(); err != nil {
+				return nil, err
+			}
+		}
+
+		t := p.next()
+		var key string
+		switch v := t.(type) {
+		case tokenizer.String:
+			s, err := v.String()
+			if err != nil {
+				return nil, err
+			}
+			key = string(s)
+		case tokenizer.Symbol:
+			key = v.SymbolName()
+		default:
+			return nil, p.errorf(t, "Expected a map key instead of %s", describe(t))
+		}
+		if seen[key] {
+			return nil, p.errorf(t, "Duplicate key '%s' in map", key)
+		}
+		seen[key] = true
+
+		if err := p.expectColon(); err != nil {
+			return nil, err
+		}
+		v, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		m.Keys = append(m.Keys, key)
+		m.Values = append(m.Values, v)
+	}
+	p.next()
+
+	m.Loc = p.loc(start)
+	return m, nil
+}
+
+// Operators that can only be used as a prefix
+func isPrefixOnly(op tokenizer.Operator) bool {
+	return op.TokenText() == "!"
+}
+
+// Convert a literal token to its value
+func literalValue(t tokenizer.Literal) (datatype.DataType, error) {
+	switch v := t.(type) {
+	case tokenizer.String:
+		return v.String()
+	case tokenizer.Integer:
+		return v.Integer()
+	case tokenizer.Double:
+		return v.Double()
+	case tokenizer.Decimal:
+		return v.Decimal()
+	case tokenizer.Duration:
+		return v.Duration()
+	case tokenizer.Bool:
+		return v.Bool()
+	case tokenizer.Null:
+		return v.Null()
+	case tokenizer.Char:
+		return v.Char()
+	}
+	return nil, tokenizer.SyntaxErrorf(t.Span(), "Unhandled literal: %s", t.TokenText())
+}
+
+// Describe a token for use in an error message
+func describe(t tokenizer.Token) string {
+	if t == nil {
+		return "end of expression"
+	}
+	return "'" + t.TokenText() + "'"
+}
@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/contactkeval/expressioneval/tokenizer"
+)
+
+func parseText(t *testing.T, text string) string {
+	t.Helper()
+	tokens, err := tokenizer.Tokenize(text)
+	if err != nil {
+		t.Fatalf("Tokenize(%q): %v", text, err)
+	}
+	n, err := Parse(tokens)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", text, err)
+	}
+	return n.String()
+}
+
+// Logical operators bind looser than relational ones, and # binds like * and /.
+// before is the grouping the original precedence table produced.
+func TestLogicalAndModuloPrecedence(t *testing.T) {
+	tests := []struct {
+		text, before, after string
+	}{
+		{"1 < 2 && 3 > 4", "((1 < (2 && 3)) > 4)", "((1 < 2) && (3 > 4))"},
+		{"1 = 2 || 3 <> 4", "((1 = (2 || 3)) <> 4)", "((1 = 2) || (3 <> 4))"},
+		{"1 || 2 && 3", "(1 || (2 && 3))", "(1 || (2 && 3))"},
+		{"1 && 2 || 3", "((1 && 2) || 3)", "((1 && 2) || 3)"},
+		{"6 * 5 # 4", "(6 * (5 # 4))", "((6 * 5) # 4)"},
+		{"6 # 5 * 4", "((6 # 5) * 4)", "((6 # 5) * 4)"},
+		{"6 + 5 # 4", "(6 + (5 # 4))", "(6 + (5 # 4))"},
+	}
+	for _, tt := range tests {
+		if got := parseText(t, tt.text); got != tt.after {
+			t.Errorf("%s parsed as %s, want %s (was %s)", tt.text, got, tt.after, tt.before)
+		}
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"a + b * c", "(a + (b * c))"},
+		{"a * b + c", "((a * b) + c)"},
+		{"a - b / c # d", "(a - ((b / c) # d))"},
+		{"a ^ b - c", "((a ^ b) - c)"},
+		{"a + b < c * d", "((a + b) < (c * d))"},
+		{"a >= b = c <= d", "(((a >= b) = c) <= d)"},
+		{"a < b && c", "((a < b) && c)"},
+		{"a & b | c & d", "((a & b) | (c & d))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a || b ?? c", "((a || b) ?? c)"},
+		{"a ?? b || c", "(a ?? (b || c))"},
+		{"a ?? b = c", "(a ?? (b = c))"},
+		{"!a && b", "((!a) && b)"},
+		{"-a * b", "((-a) * b)"},
+		{"!a = b", "((!a) = b)"},
+		{"<D>a / b", "((<Double>a) / b)"},
+		{"-a{1}", "(-a{1})"},
+		{"(a + b) * c", "((a + b) * c)"},
+		{"a + b : c * d", "((a + b) : (c * d))"},
+		{"a || b ? c + d : e", "((a || b) ? (c + d) : e)"},
+		{"a ?? b ? c : d", "((a ?? b) ? c : d)"},
+	}
+	for _, tt := range tests {
+		if got := parseText(t, tt.text); got != tt.want {
+			t.Errorf("%s parsed as %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestAssociativity(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"a - b - c", "((a - b) - c)"},
+		{"a / b / c", "((a / b) / c)"},
+		{"a # b # c", "((a # b) # c)"},
+		{"a - b + c", "((a - b) + c)"},
+		{"a < b = c", "((a < b) = c)"},
+		{"a && b && c", "((a && b) && c)"},
+		{"a || b || c", "((a || b) || c)"},
+		{"a ?? b ?? c", "((a ?? b) ?? c)"},
+		{"!!a", "(!(!a))"},
+		{"- -a", "(-(-a))"},
+		{"a ? b : c ? d : e", "(a ? b : (c ? d : e))"},
+		{"a ? b ? c : d : e", "(a ? (b ? c : d) : e)"},
+	}
+	for _, tt := range tests {
+		if got := parseText(t, tt.text); got != tt.want {
+			t.Errorf("%s parsed as %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	tests := map[string]bool{
+		strings.Repeat("(", MaxDepth-1) + "1" + strings.Repeat(")", MaxDepth-1): true,
+		strings.Repeat("(", MaxDepth) + "1" + strings.Repeat(")", MaxDepth):     false,
+		strings.Repeat("-", MaxDepth-1) + "1":                                   true,
+		strings.Repeat("!", MaxDepth) + "true":                                  false,
+		strings.Repeat("a ? b : ", MaxDepth) + "c":                              false,
+		"1" + strings.Repeat(" + 1", MaxDepth-2):                                true,
+		"1" + strings.Repeat(" + 1", MaxDepth):                                  false,
+		"a" + strings.Repeat("{0}", MaxDepth):                                   false,
+		"(a)" + strings.Repeat(".b", MaxDepth):                                  false,
+		strings.Repeat("[", MaxDepth+1) + strings.Repeat("]", MaxDepth+1):       false,
+	}
+	for text, ok := range tests {
+		tokens, err := tokenizer.Tokenize(text)
+		if err != nil {
+			t.Fatalf("Tokenize(%.20s...): %v", text, err)
+		}
+		_, err = Parse(tokens)
+		if ok && err != nil {
+			t.Errorf("Parse(%.20s...): %v", text, err)
+		}
+		if !ok {
+			var se *tokenizer.SyntaxError
+			if !errors.As(err, &se) || !strings.Contains(se.Error(), "nested more than") {
+				t.Errorf("Parse(%.20s...) = %v, want a SyntaxError for the depth", text, err)
+			}
+		}
+	}
+}
+
+func TestTernary(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"a ? b : c", "(a ? b : c)"},
+		{"a > 1 ? b + 1 : c * 2", "((a > 1) ? (b + 1) : (c * 2))"},
+		{"a ? b : c ? d : e ? f : g", "(a ? b : (c ? d : (e ? f : g)))"},
+		{"(a ? b : c) ? d : e", "((a ? b : c) ? d : e)"},
+		{"a ? [b, c] : d", "(a ? [b, c] : d)"},
+		// The legacy form gives the same node
+		{"?(a : b, c)", "(a ? b : c)"},
+		{"?(a > 1 : b, ?(c : d, e))", "((a > 1) ? b : (c ? d : e))"},
+		{"?(a : b, c) + 1", "((a ? b : c) + 1)"},
+	}
+	for _, tt := range tests {
+		if got := parseText(t, tt.text); got != tt.want {
+			t.Errorf("%s parsed as %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTernaryErrors(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"a ? b", "Expected ':' instead of end of expression at line 1, column 6"},
+		{"a ? b :", "Expected a value instead of end of expression at line 1, column 8"},
+		{"a ? : b", "Expected a value instead of ':' at line 1, column 5"},
+		{"? a : b", "Expected '(' after '?' instead of 'a' at line 1, column 3"},
+		{"?(a : b)", "Expected ',' instead of ')' at line 1, column 8"},
+	}
+	for _, tt := range tests {
+		tokens, err := tokenizer.Tokenize(tt.text)
+		if err != nil {
+			t.Fatalf("Tokenize(%q): %v", tt.text, err)
+		}
+		_, err = Parse(tokens)
+		var se *tokenizer.SyntaxError
+		if !errors.As(err, &se) || se.Error() != tt.want {
+			t.Errorf("Parse(%q) = %v, want %s", tt.text, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package tokenizer
+
+import (
+	"testing"
+)
+
+func TestCommentTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"1 // a comment", "integer 1, comment // a comment"},
+		{"1 // a comment\n+ 2", "integer 1, comment // a comment, arithmetic_op +, integer 2"},
+		{"1 /* a\nblock */ + 2", "integer 1, comment /* a\nblock */, arithmetic_op +, integer 2"},
+		{"1 /**/ + 2", "integer 1, comment /**/, arithmetic_op +, integer 2"},
+		{"1 /* a /* b */ + 2", "integer 1, comment /* a /* b */, arithmetic_op +, integer 2"},
+		{"1/*a*//*b*/+2", "integer 1, comment /*a*/, comment /*b*/, arithmetic_op +, integer 2"},
+		{"1 /* a */", "integer 1, comment /* a */"},
+		{"1 //", "integer 1, comment //"},
+		{"// only a comment", "comment // only a comment"},
+		{"4 / 2", "integer 4, arithmetic_op /, integer 2"},
+		{`"/* not */" + "//"`, `string "/* not */", arithmetic_op +, string "//"`},
+	}
+	for _, tt := range tests {
+		tokens, err := Tokenize(tt.text)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.text, err)
+			continue
+		}
+		if got := tokenSummary(tokens); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCommentsAreTrivia(t *testing.T) {
+	tokens, err := Tokenize("1 /* one */ + // plus\n 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var comments []Token
+	for _, tok := range tokens {
+		if _, ok := tok.(Comment); ok {
+			comments = append(comments, tok)
+		}
+	}
+	if len(comments) != 2 {
+		t.Fatalf("got %d comments, want 2", len(comments))
+	}
+	if got, want := comments[1].Span(), (Span{Position{14, 1, 15}, Position{21, 1, 22}}); got != want {
+		t.Errorf("got span %+v for %q, want %+v", got, comments[1].TokenText(), want)
+	}
+
+	for _, tok := range tokens.WithoutTrivia() {
+		if _, ok := tok.(Trivia); ok {
+			t.Errorf("WithoutTrivia kept %q", tok.TokenText())
+		}
+	}
+	if got, want := len(tokens.WithoutTrivia()), 3; got != want {
+		t.Errorf("got %d tokens without trivia, want %d", got, want)
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"1 /* a", "Missing */ for comment: /* a at line 1, column 3"},
+		{"1 /* a\nb */ + /* c", "Missing */ for comment: /* c at line 2, column 8"},
+		{"/*/", "Missing */ for comment: /*/ at line 1, column 1"},
+		{"1 /* a *", "Missing */ for comment: /* a * at line 1, column 3"},
+	}
+	for _, tt := range tests {
+		_, err := Tokenize(tt.text)
+		if _, ok := err.(*SyntaxError); !ok || err.Error() != tt.want {
+			t.Errorf("%q: got error %v, want %s", tt.text, err, tt.want)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package tokenizer
 
 import (
+	"errors"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/contactkeval/expressioneval/datatype"
 )
@@ -11,6 +13,7 @@ import (
 type baseToken struct {
 	tokenType TokenType
 	text      string // The text that was matched for the token
+	span      Span   // Where the text is in the expression
 }
 
 func (t baseToken) TokenType() TokenType {
@@ -21,6 +24,10 @@ func (t baseToken) TokenText() string {
 	return t.text
 }
 
+func (t baseToken) Span() Span {
+	return t.span
+}
+
 // Bool value
 type boolToken struct {
 	baseToken
@@ -28,14 +35,14 @@ type boolToken struct {
 
 func (t boolToken) Literal() {}
 
-func (t boolToken) Bool() datatype.Bool {
+func (t boolToken) Bool() (datatype.Bool, error) {
 	switch strings.ToLower(t.TokenText()) {
 	case "true":
-		return true
+		return true, nil
 	case "false":
-		return false
+		return false, nil
 	default:
-		panic("Invalid boolean value")
+		return false, SyntaxErrorf(t.span, "Invalid boolean value: %s", t.TokenText())
 	}
 }
 
@@ -43,6 +50,21 @@ func (t boolToken) DataType() string {
 	return datatype.DataTypeBool
 }
 
+// The null value
+type nullToken struct {
+	baseToken
+}
+
+func (t nullToken) Literal() {}
+
+func (t nullToken) Null() (datatype.Null, error) {
+	return datatype.Null{}, nil
+}
+
+func (t nullToken) DataType() string {
+	return datatype.DataTypeNull
+}
+
 // Double value
 type doubleToken struct {
 	baseToken
@@ -50,18 +72,63 @@ type doubleToken struct {
 
 func (t doubleToken) Literal() {}
 
-func (t doubleToken) Double() datatype.Double {
-	d, err := strconv.ParseFloat(t.TokenText(), 64)
+func (t doubleToken) Double() (datatype.Double, error) {
+	d, err := strconv.ParseFloat(strings.Replace(t.TokenText(), "_", "", -1), 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, SyntaxErrorf(t.span, "Double value %s is out of range", t.TokenText())
+	}
 	if err != nil {
-		panic("Unexpected Double token: " + t.TokenText())
+		return 0, SyntaxErrorf(t.span, "Invalid Double value: %s", t.TokenText())
 	}
-	return datatype.Double(d)
+	return datatype.Double(d), nil
 }
 
 func (t doubleToken) DataType() string {
 	return datatype.DataTypeDouble
 }
 
+// Decimal value, a number with an M suffix
+type decimalToken struct {
+	baseToken
+}
+
+func (t decimalToken) Literal() {}
+
+func (t decimalToken) Decimal() (datatype.Decimal, error) {
+	text := strings.Replace(strings.TrimSuffix(t.TokenText(), "M"), "_", "", -1)
+	d, err := datatype.ParseDecimal(text)
+	if errors.Is(err, datatype.ErrDecimalRange) {
+		return datatype.Decimal{}, SyntaxErrorf(t.span, "Decimal value out of range: %s", t.TokenText())
+	}
+	if err != nil {
+		return datatype.Decimal{}, SyntaxErrorf(t.span, "Invalid Decimal value: %s", t.TokenText())
+	}
+	return d, nil
+}
+
+func (t decimalToken) DataType() string {
+	return datatype.DataTypeDecimal
+}
+
+// Duration value, eg. 2h30m or P1DT2H
+type durationToken struct {
+	baseToken
+}
+
+func (t durationToken) Literal() {}
+
+func (t durationToken) Duration() (datatype.Duration, error) {
+	d, err := datatype.ParseDuration(t.TokenText())
+	if err != nil {
+		return 0, SyntaxErrorf(t.span, "%v", err)
+	}
+	return d, nil
+}
+
+func (t durationToken) DataType() string {
+	return datatype.DataTypeDuration
+}
+
 // Int value
 type integerToken struct {
 	baseToken
@@ -69,12 +136,37 @@ type integerToken struct {
 
 func (t integerToken) Literal() {}
 
-func (t integerToken) Integer() datatype.Int {
-	d, err := strconv.Atoi(t.TokenText())
+func (t integerToken) Integer() (datatype.Int, error) {
+	text := strings.Replace(t.TokenText(), "_", "", -1)
+
+	sign := ""
+	if strings.HasPrefix(text, "-") {
+		sign, text = "-", text[1:]
+	}
+
+	base := 10
+	if len(text) > 1 && text[0] == '0' {
+		switch text[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			text = text[2:]
+		}
+	}
+
+	d, err := strconv.ParseInt(sign+text, base, strconv.IntSize)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, SyntaxErrorf(t.span, "Int value %s is out of range", t.TokenText())
+	}
 	if err != nil {
-		panic("Unexpected Integer token: " + t.TokenText())
+		return 0, SyntaxErrorf(t.span, "Invalid Int value: %s", t.TokenText())
 	}
-	return datatype.Int(d)
+	return datatype.Int(d), nil
 }
 
 func (t integerToken) DataType() string {
@@ -88,12 +180,17 @@ type charToken struct {
 
 func (t charToken) Literal() {}
 
-func (t charToken) Char() datatype.Char {
-	if t.TokenText() == `'\''` {
-		return datatype.Char('\'')
-	} else {
-		return datatype.Char(t.TokenText()[1])
+func (t charToken) Char() (datatype.Char, error) {
+	text := t.TokenText()
+	s, err := unescape(text[1 : len(text)-1])
+	if err != nil {
+		return 0, SyntaxErrorf(t.span, "Invalid escape sequence in %s", text)
 	}
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, SyntaxErrorf(t.span, "Char value %s should be a single character", text)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return datatype.Char(r), nil
 }
 
 func (t charToken) DataType() string {
@@ -107,34 +204,65 @@ type stringToken struct {
 
 func (t stringToken) Literal() {}
 
-func (t stringToken) String() datatype.String {
-	s := t.TokenText()[1:]
-	s = s[0 : len(s)-1]
-
-	r := strings.NewReplacer(
-		`\'`, `'`,
-		`\"`, `"`,
-		`\\`, `\`,
-	)
-
-	s = r.Replace(s)
+// The text between the quotes, with escape sequences replaced. A raw string,
+// quoted with backticks, is used as is.
+func (t stringToken) String() (datatype.String, error) {
+	text := t.TokenText()
+	body := text[1 : len(text)-1]
+	if text[0] == '`' {
+		return datatype.String(body), nil
+	}
 
-	return datatype.String(s)
+	s, err := unescape(body)
+	if err != nil {
+		return "", SyntaxErrorf(t.span, "Invalid escape sequence in %s", text)
+	}
+	return datatype.String(s), nil
 }
 
 func (t stringToken) DataType() string {
 	return datatype.DataTypeString
 }
 
+// Replace the escape sequences in the text of a string or char literal. The
+// sequences are the same as in Go, eg. \n, \t, \u00e9 or \U0010FFFF. Both
+// \' and \" can be used in either kind of literal.
+func unescape(s string) (string, error) {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for len(s) > 0 {
+		if strings.HasPrefix(s, `\'`) || strings.HasPrefix(s, `\"`) {
+			b.WriteByte(s[1])
+			s = s[2:]
+			continue
+		}
+
+		r, multibyte, tail, err := strconv.UnquoteChar(s, 0)
+		if err != nil {
+			return "", err
+		}
+		if multibyte {
+			b.WriteRune(r)
+		} else {
+			// A single byte, which may be part of a UTF-8 sequence written
+			// as \x escapes
+			b.WriteByte(byte(r))
+		}
+		s = tail
+	}
+	return b.String(), nil
+}
+
 // Intrinsic method
 type intrinsicMethodToken struct {
 	baseToken
 }
 
+// The '(' that follows the name is a separate token
 func (t intrinsicMethodToken) IntrinsicMethodName() string {
-	// Remove trailing '('
-	//return t.TokenText()[:len(t.TokenText())-1]
-	//TokenText without reducing lenght-Rajdeep-22/9/2017
 	return t.TokenText()
 }
 
@@ -160,6 +288,24 @@ func (t whitespaceToken) Whitespace() string {
 	return t.TokenText()
 }
 
+func (t whitespaceToken) Trivia() {}
+
+// Comment
+type commentToken struct {
+	baseToken
+}
+
+// The text of the comment without the comment markers
+func (t commentToken) Comment() string {
+	text := t.TokenText()
+	if strings.HasPrefix(text, "/*") {
+		return text[2 : len(text)-2]
+	}
+	return text[2:]
+}
+
+func (t commentToken) Trivia() {}
+
 // Comma operator - separates items in a list or method arguments
 type commaToken struct {
 	baseToken
@@ -199,6 +345,15 @@ func (t questionToken) Precedence() int {
 	return PrecedenceMethod
 }
 
+// Dot is used to access a member of a value
+type dotToken struct {
+	baseToken
+}
+
+func (t dotToken) Dot() string {
+	return t.TokenText()
+}
+
 // Airthmetic Operator
 type arithmeticOperatorToken struct {
 	baseToken
@@ -240,6 +395,19 @@ func (t logicalOperatorToken) Precedence() int {
 }
 func (t logicalOperatorToken) Operator() {}
 
+// Null coalescing operator
+type coalesceOperatorToken struct {
+	baseToken
+}
+
+func (t coalesceOperatorToken) CoalesceOperator() string {
+	return t.TokenText()
+}
+func (t coalesceOperatorToken) Precedence() int {
+	return PrecedenceCoalesce
+}
+func (t coalesceOperatorToken) Operator() {}
+
 // Open bracket
 type openBracketToken struct {
 	baseToken
@@ -266,7 +434,7 @@ func (t closeBracketToken) CloseBracket() string {
 	case "}":
 		return "{"
 	default:
-		panic("Unknown bracket: " + t.TokenText())
+		return ""
 	}
 }
 func (t closeBracketToken) Precedence() int {
@@ -278,25 +446,29 @@ type typeCastToken struct {
 	baseToken
 }
 
-func (t typeCastToken) CastDataType() string {
+func (t typeCastToken) CastDataType() (string, error) {
 	dt := t.TokenText()
 	dt = dt[1 : len(dt)-1]
 	dt = strings.ToLower(dt)
 	switch dt {
 	case "b", "bool":
-		return datatype.DataTypeBool
+		return datatype.DataTypeBool, nil
 	case "s", "string":
-		return datatype.DataTypeString
+		return datatype.DataTypeString, nil
 	case "i", "int", "int32":
-		return datatype.DataTypeInt
+		return datatype.DataTypeInt, nil
 	case "d", "double":
-		return datatype.DataTypeDouble
+		return datatype.DataTypeDouble, nil
+	case "m", "decimal":
+		return datatype.DataTypeDecimal, nil
 	case "c", "char":
-		return datatype.DataTypeChar
+		return datatype.DataTypeChar, nil
 	case "h", "datetime":
-		return datatype.DataTypeDateTime
+		return datatype.DataTypeDateTime, nil
+	case "duration", "timespan":
+		return datatype.DataTypeDuration, nil
 	default:
-		panic("Unknown data type: " + dt)
+		return "", SyntaxErrorf(t.span, "Unknown data type: %s", dt)
 	}
 }
 func (t typeCastToken) Precedence() int { return PrecedenceTypeCast }
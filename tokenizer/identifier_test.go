@@ -0,0 +1,84 @@
+package tokenizer
+
+import (
+	"testing"
+)
+
+func TestIdentifierTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"MyInt", "symbol MyInt"},
+		{"Math.PI", "symbol Math.PI"},
+		{"Order.Customer.Name", "symbol Order.Customer.Name"},
+		{"Item2.Price3", "symbol Item2.Price3"},
+		{"Max(1)", "intrinsic_method Max, open_bracket (, integer 1, close_bracket )"},
+		{"Max (1)", "intrinsic_method Max, open_bracket (, integer 1, close_bracket )"},
+		{"Math.Abs(1)", "intrinsic_method Math.Abs, open_bracket (, integer 1, close_bracket )"},
+		{"Max[1]", "symbol Max, open_bracket [, integer 1, close_bracket ]"},
+		{"a.1", "symbol a, double .1"},
+		{"a..b", "symbol a, dot ., dot ., symbol b"},
+		{"a. b", "symbol a, dot ., symbol b"},
+		{"(a).b", "open_bracket (, symbol a, close_bracket ), dot ., symbol b"},
+		{"true", "bool true"},
+		{"TRUE", "bool TRUE"},
+		{"truex", "symbol truex"},
+		{"nullable", "symbol nullable"},
+		{"Straße", "symbol Straße"},
+		{"café + 1", "symbol café, arithmetic_op +, integer 1"},
+		{"Kunde.Größe", "symbol Kunde.Größe"},
+		{"Ωmega", "symbol Ωmega"},
+		{"名前(1)", "intrinsic_method 名前, open_bracket (, integer 1, close_bracket )"},
+		{"trueé", "symbol trueé"},
+	}
+	for _, tt := range tests {
+		tokens, err := Tokenize(tt.text)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.text, err)
+			continue
+		}
+		if got := tokenSummary(tokens); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestIdentifierSpans(t *testing.T) {
+	// Columns count characters, offsets count bytes
+	tokens, err := Tokenize("Größe + café")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens = tokens.WithoutTrivia()
+	want := []Span{
+		{Position{0, 1, 1}, Position{7, 1, 6}},
+		{Position{8, 1, 7}, Position{9, 1, 8}},
+		{Position{10, 1, 9}, Position{15, 1, 13}},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for i, tok := range tokens {
+		if got := tok.Span(); got.Start != want[i].Start || got.End != want[i].End {
+			t.Errorf("%q: got span %+v, want %+v", tok.TokenText(), got, want[i])
+		}
+	}
+}
+
+func TestIdentifierErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"_a", "Could not find a token starting at: _a at line 1, column 1"},
+		{"a_b", "Could not find a token starting at: _b at line 1, column 2"},
+		{"a € b", "Could not find a token starting at: € b at line 1, column 3"},
+	}
+	for _, tt := range tests {
+		_, err := Tokenize(tt.text)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: got error %v, want %s", tt.text, err, tt.want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import "github.com/contactkeval/expressioneval/datatype"
 type Token interface {
 	TokenType() TokenType
 	TokenText() string
+	Span() Span
 }
 
 // List of tokens
@@ -23,6 +24,19 @@ func (ts Tokens) WithoutWhitespace() Tokens {
 	return nts
 }
 
+// Remove whitespaces and comments, which don't affect the value of an
+// expression
+func (ts Tokens) WithoutTrivia() Tokens {
+	var nts []Token
+	for _, t := range ts {
+		if _, ok := t.(Trivia); ok {
+			continue
+		}
+		nts = append(nts, t)
+	}
+	return nts
+}
+
 type Literal interface {
 	Token
 	Literal()
@@ -47,27 +61,42 @@ type OperationWithPrecedence interface {
 
 type Bool interface {
 	Literal
-	Bool() datatype.Bool
+	Bool() (datatype.Bool, error)
+}
+
+type Null interface {
+	Literal
+	Null() (datatype.Null, error)
 }
 
 type Char interface {
 	Literal
-	Char() datatype.Char
+	Char() (datatype.Char, error)
 }
 
 type Double interface {
 	Literal
-	Double() datatype.Double
+	Double() (datatype.Double, error)
+}
+
+type Decimal interface {
+	Literal
+	Decimal() (datatype.Decimal, error)
+}
+
+type Duration interface {
+	Literal
+	Duration() (datatype.Duration, error)
 }
 
 type Integer interface {
 	Literal
-	Integer() datatype.Int
+	Integer() (datatype.Int, error)
 }
 
 type String interface {
 	Literal
-	String() datatype.String
+	String() (datatype.String, error)
 }
 
 type IntrinsicMethod interface {
@@ -80,11 +109,24 @@ type Symbol interface {
 	SymbolName() string
 }
 
-type Whitespace interface {
+// Tokens that can appear between any other tokens and are ignored by the
+// parser
+type Trivia interface {
 	Token
+	Trivia()
+}
+
+type Whitespace interface {
+	Trivia
 	Whitespace() string
 }
 
+// A // line comment or a /* */ block comment
+type Comment interface {
+	Trivia
+	Comment() string
+}
+
 type Comma interface {
 	Token
 	Comma() string
@@ -100,6 +142,11 @@ type Question interface {
 	Question() string
 }
 
+type Dot interface {
+	Token
+	Dot() string
+}
+
 type ArithmeticOperator interface {
 	Operator
 	ArithmeticOperator() string
@@ -115,12 +162,18 @@ type LogicalOperator interface {
 	LogicalOperator() string
 }
 
+type CoalesceOperator interface {
+	Operator
+	CoalesceOperator() string
+}
+
 type OpenBracket interface {
 	Token
 	OperationWithPrecedence
 	OpenBracket() string
 }
 
+// CloseBracket returns the matching open bracket, or "" if it is unknown
 type CloseBracket interface {
 	Token
 	OperationWithPrecedence
@@ -129,5 +182,5 @@ type CloseBracket interface {
 
 type TypeCast interface {
 	Token
-	CastDataType() string
+	CastDataType() (string, error)
 }
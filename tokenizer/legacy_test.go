@@ -0,0 +1,279 @@
+package tokenizer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// Token pattern of the legacy tokenizer
+type legacyTokenPat struct {
+	pat         string                // A regular expression
+	tokenType   TokenType             // Type of the token
+	constructor func(baseToken) Token // Constructor that can build the token from the matched string
+}
+
+// Check if the string s starts with this token. start is the position of s
+// in the expression.
+func (tp legacyTokenPat) Match(s string, start Position) Token {
+	re := regexp.MustCompile("^(" + tp.pat + ")")
+
+	if text := re.FindString(s); text != "" {
+		bt := baseToken{text: text, tokenType: tp.tokenType, span: Span{start, start.advance(text)}}
+		return tp.constructor(bt)
+	}
+	return nil
+}
+
+// A name, with optional dotted parts
+const legacyIdentifierPat = `[a-zA-Z]+[a-zA-Z0-9]*(\.[a-zA-Z]+[a-zA-Z0-9]*)*`
+
+// Tokens are defined using regular expressions, embeded in legacyTokenPat{} structs.
+// The order of the token patterns is important since the earliest matched
+// pattern determines the token (except for any exceptions defined in Tokenize())
+var legacyTokenPats []legacyTokenPat = []legacyTokenPat{
+	legacyTokenPat{`\<(?i:B|Bool|S|String|D|Double|I|Int|Int32|C|Char|H|DateTime)\>`, TokenTypeTypeCast,
+		func(bt baseToken) Token { return typeCastToken{bt} }},
+
+	legacyTokenPat{`!`, TokenTypeLogicalOperator,
+		func(bt baseToken) Token { return logicalOperatorToken{bt} }},
+	legacyTokenPat{`&&|&`, TokenTypeLogicalOperator,
+		func(bt baseToken) Token { return logicalOperatorToken{bt} }},
+	legacyTokenPat{`\|\||\|`, TokenTypeLogicalOperator,
+		func(bt baseToken) Token { return logicalOperatorToken{bt} }},
+
+	legacyTokenPat{`\+`, TokenTypeArithmeticOperator,
+		func(bt baseToken) Token { return arithmeticOperatorToken{bt} }},
+	legacyTokenPat{`-`, TokenTypeArithmeticOperator,
+		func(bt baseToken) Token { return arithmeticOperatorToken{bt} }},
+	legacyTokenPat{`\*`, TokenTypeArithmeticOperator,
+		func(bt baseToken) Token { return arithmeticOperatorToken{bt} }},
+	legacyTokenPat{`/`, TokenTypeArithmeticOperator,
+		func(bt baseToken) Token { return arithmeticOperatorToken{bt} }},
+	legacyTokenPat{`#`, TokenTypeArithmeticOperator,
+		func(bt baseToken) Token { return arithmeticOperatorToken{bt} }},
+	legacyTokenPat{`\^`, TokenTypeArithmeticOperator,
+		func(bt baseToken) Token { return arithmeticOperatorToken{bt} }},
+
+	legacyTokenPat{RelationalOperatorEqualTo, TokenTypeRelationalOperator,
+		func(bt baseToken) Token { return relationalOperatorToken{bt} }},
+	legacyTokenPat{RelationalOperatorNotEqualTo, TokenTypeRelationalOperator,
+		func(bt baseToken) Token { return relationalOperatorToken{bt} }},
+	legacyTokenPat{RelationalOperatorGreaterOrEqualTo, TokenTypeRelationalOperator,
+		func(bt baseToken) Token { return relationalOperatorToken{bt} }},
+	legacyTokenPat{RelationalOperatorLesserOrEqualTo, TokenTypeRelationalOperator,
+		func(bt baseToken) Token { return relationalOperatorToken{bt} }},
+	legacyTokenPat{RelationalOperatorGreater, TokenTypeRelationalOperator,
+		func(bt baseToken) Token { return relationalOperatorToken{bt} }},
+	legacyTokenPat{RelationalOperatorLesser, TokenTypeRelationalOperator,
+		func(bt baseToken) Token { return relationalOperatorToken{bt} }},
+
+	legacyTokenPat{`\(`, TokenTypeOpenBracket,
+		func(bt baseToken) Token { return openBracketToken{bt} }},
+	legacyTokenPat{`\)`, TokenTypeCloseBracket,
+		func(bt baseToken) Token { return closeBracketToken{bt} }},
+	legacyTokenPat{`\[`, TokenTypeOpenBracket,
+		func(bt baseToken) Token { return openBracketToken{bt} }},
+	legacyTokenPat{`\]`, TokenTypeCloseBracket,
+		func(bt baseToken) Token { return closeBracketToken{bt} }},
+	legacyTokenPat{`\{`, TokenTypeOpenBracket,
+		func(bt baseToken) Token { return openBracketToken{bt} }},
+	legacyTokenPat{`\}`, TokenTypeCloseBracket,
+		func(bt baseToken) Token { return closeBracketToken{bt} }},
+
+	legacyTokenPat{`(?i:true|false)\b`, TokenTypeBool,
+		func(bt baseToken) Token { return boolToken{bt} }},
+
+	// Identifiers, including dotted names like Math.PI, are symbols unless they
+	// are followed by a '(' (see Tokenize)
+	legacyTokenPat{legacyIdentifierPat, TokenTypeSymbol,
+		func(bt baseToken) Token { return symbolToken{bt} }},
+
+	legacyTokenPat{`\s+`, TokenTypeWhitespace,
+		func(bt baseToken) Token { return whitespaceToken{bt} }},
+	legacyTokenPat{`,`, TokenTypeComma,
+		func(bt baseToken) Token { return commaToken{bt} }},
+	legacyTokenPat{`:`, TokenTypeColon,
+		func(bt baseToken) Token { return colonToken{bt} }},
+	legacyTokenPat{`\?`, TokenTypeQuestion,
+		func(bt baseToken) Token { return questionToken{bt} }},
+	legacyTokenPat{`\.`, TokenTypeDot,
+		func(bt baseToken) Token { return dotToken{bt} }},
+
+	legacyTokenPat{`[+-]?[0-9]+\.[0-9]+`, TokenTypeDouble,
+		func(bt baseToken) Token { return doubleToken{bt} }},
+	legacyTokenPat{`[+-]?[0-9]+`, TokenTypeInteger,
+		func(bt baseToken) Token { return integerToken{bt} }},
+	legacyTokenPat{`"(\\"|[^"])*"`, TokenTypeString,
+		func(bt baseToken) Token { return stringToken{bt} }},
+	legacyTokenPat{`'(\\'|[^'])'`, TokenTypeChar,
+		func(bt baseToken) Token { return charToken{bt} }},
+}
+
+// The regexp based tokenizer that the scanner replaced, kept to check that
+// the scanner gives the same tokens for expressions the old one supported
+func legacyTokenize(s string) (Tokens, error) {
+	var tokens []Token
+
+	var rem string // remaining string to tokenize
+	pos := startPosition
+
+	rem = s
+	for rem != "" {
+		var matchedTokens []Token
+
+		for _, tp := range legacyTokenPats {
+			if t := tp.Match(rem, pos); t != nil {
+				matchedTokens = append(matchedTokens, t)
+			}
+		}
+
+		if len(matchedTokens) == 0 {
+			return tokens, SyntaxErrorf(Span{pos, pos.advance(rem[:1])}, "Could not find a token starting at: %s", rem)
+		}
+
+		matchedToken := matchedTokens[0]
+
+		// The special unary '-'. If a '-' is at the start of the string OR
+		// follows an operator OR follows an open bracket, then consider it and
+		// the following digits as a single numerical token.
+		if matchedTokens[0].TokenText() == "-" && len(matchedTokens) == 2 {
+			switch matchedTokens[1].TokenType() {
+			case TokenTypeInteger, TokenTypeDouble:
+				isUnaryMinus := false
+				if len(tokens) == 0 {
+					isUnaryMinus = true
+				} else {
+					switch tokens[len(tokens)-1].(type) {
+					case Operator, OpenBracket, Comma, Colon:
+						isUnaryMinus = true
+					}
+				}
+
+				if isUnaryMinus {
+					matchedToken = matchedTokens[1]
+				}
+			}
+		}
+
+		// An identifier followed by a '(' is the name of an intrinsic method.
+		// Any other identifier refers to a symbol.
+		if sym, ok := matchedToken.(symbolToken); ok && legacyIsFollowedByOpenParan(rem[len(sym.TokenText()):]) {
+			sym.tokenType = TokenTypeIntrinsicMethod
+			matchedToken = intrinsicMethodToken{sym.baseToken}
+		}
+
+		tokens = append(tokens, matchedToken)
+		rem = rem[len(matchedToken.TokenText()):]
+		pos = matchedToken.Span().End
+	}
+
+	return tokens, nil
+}
+
+// Check if the next token in s, ignoring white space, is a '('
+func legacyIsFollowedByOpenParan(s string) bool {
+	return strings.HasPrefix(strings.TrimLeftFunc(s, unicode.IsSpace), BracketParans)
+}
+
+// Expressions in the language the legacy tokenizer supported
+var legacyCorpus = []string{
+	`1 + 2 * 3`,
+	`-1 + -2.5 * (3 - -4)`,
+	`1-2`,
+	`(1)-2`,
+	`[1, -2, 3.25]{0:-1}`,
+	`MyInt >= 100 && MyDouble <= 400.0 || !(MyInt <> 5)`,
+	`a = b & c | d`,
+	`10 # 3 ^ 2 / 4`,
+	`"abc" + 'd' + "with \" quote"`,
+	`'x' < 'y'`,
+	`StartsWith("Mr. John Smith Jr.", ["Miss.", "Mrs.", "Sir"])`,
+	`Piece ( "a,b,c" , "," , 2 )`,
+	`Math.PI * 2`,
+	`Order.Customer.Name`,
+	`x.y.z(1)`,
+	`<I>"12" + <D>"1.5" + <int32>MyDouble`,
+	`<S>[1, 2] + <B>"true" + <c>"a" + <H>"01/02/2006" + <DateTime>"12/31/2024"`,
+	`TRUE && False || true`,
+	`truex || falsey`,
+	`?(MyInt > 5 : "big", "small")`,
+	`MyInt > 5 ? 1 : 2`,
+	`[1, 2]{0}`,
+	"\t1\n+\r\n  2  ",
+	`DateTime.Today + 1`,
+	`JsonSelect(JSONString, "store.book[0].author")`,
+	`a.b`,
+	`Max(TestArray) - Min(TestArray)`,
+	`"unterminated`,
+	`1 $ 2`,
+	``,
+}
+
+type legacyToken struct {
+	Type TokenType
+	Text string
+	Span Span
+}
+
+// The tokens with the sign of a number as a separate '-' token. The legacy
+// tokenizer only made the sign part of the number if the token right before
+// it was an operator, a bracket, a comma or a colon, so "1 + -2" had a '-'
+// token because of the space. The scanner ignores white space when it
+// decides, which gives the same value.
+func legacyTokens(tokens Tokens) []legacyToken {
+	var ts []legacyToken
+	for _, t := range tokens {
+		text, span := t.TokenText(), t.Span()
+		isNumber := t.TokenType() == TokenTypeInteger || t.TokenType() == TokenTypeDouble
+		if isNumber && strings.HasPrefix(text, "-") {
+			signEnd := span.Start
+			signEnd.Offset++
+			signEnd.Column++
+			ts = append(ts, legacyToken{TokenTypeArithmeticOperator, "-", Span{span.Start, signEnd}})
+			text, span.Start = text[1:], signEnd
+		}
+		ts = append(ts, legacyToken{t.TokenType(), text, span})
+	}
+	return ts
+}
+
+func TestTokenizeMatchesLegacy(t *testing.T) {
+	for _, text := range legacyCorpus {
+		want, wantErr := legacyTokenize(text)
+		got, gotErr := Tokenize(text)
+
+		if (gotErr != nil) != (wantErr != nil) {
+			t.Errorf("%q: error %v, legacy error %v", text, gotErr, wantErr)
+			continue
+		}
+		if wantErr != nil {
+			continue
+		}
+		if g, w := fmt.Sprint(legacyTokens(got)), fmt.Sprint(legacyTokens(want)); g != w {
+			t.Errorf("%q:\n got  %s\n want %s", text, g, w)
+		}
+	}
+}
+
+func BenchmarkTokenize(b *testing.B) {
+	text := strings.Repeat(`StartsWith(Order.Customer.Name, ["Miss.", "Mrs.", "Sir"]) && Amount * 1.25 >= <D>"100.5" || `, 20) + "true"
+	b.SetBytes(int64(len(text)))
+	for i := 0; i < b.N; i++ {
+		if _, err := Tokenize(text); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTokenizeLegacy(b *testing.B) {
+	text := strings.Repeat(`StartsWith(Order.Customer.Name, ["Miss.", "Mrs.", "Sir"]) && Amount * 1.25 >= <D>"100.5" || `, 20) + "true"
+	b.SetBytes(int64(len(text)))
+	for i := 0; i < b.N; i++ {
+		if _, err := legacyTokenize(text); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/contactkeval/expressioneval/datatype"
+)
+
+// The type and text of each token, without white space
+func tokenSummary(tokens Tokens) string {
+	var out []string
+	for _, t := range tokens {
+		if _, ok := t.(Whitespace); ok {
+			continue
+		}
+		out = append(out, fmt.Sprintf("%s %s", t.TokenType(), t.TokenText()))
+	}
+	return strings.Join(out, ", ")
+}
+
+func TestNumberTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"123", "integer 123"},
+		{"1_000_000", "integer 1_000_000"},
+		{"0x1F", "integer 0x1F"},
+		{"0X1f", "integer 0X1f"},
+		{"0o17", "integer 0o17"},
+		{"0b1010", "integer 0b1010"},
+		{"0b12", "integer 0b1, integer 2"},
+		{"0x", "integer 0x"},
+		{"1.5", "double 1.5"},
+		{".5", "double .5"},
+		{"5.", "double 5."},
+		{"1e6", "double 1e6"},
+		{"1E-3", "double 1E-3"},
+		{"1e+2", "double 1e+2"},
+		{"1.5e3", "double 1.5e3"},
+		{"1_0.2_5", "double 1_0.2_5"},
+		{"1e", "integer 1, symbol e"},
+		{"10.50M", "decimal 10.50M"},
+		{"5M", "decimal 5M"},
+		{"5.Abs", "integer 5, dot ., symbol Abs"},
+		{"-2", "integer -2"},
+		{"1 -2", "integer 1, arithmetic_op -, integer 2"},
+		{"2h30m", "duration 2h30m"},
+	}
+	for _, tt := range tests {
+		tokens, err := Tokenize(tt.text)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.text, err)
+			continue
+		}
+		if got := tokenSummary(tokens); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestNumberTokenErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"1__0", "Could not find a token starting at: __0 at line 1, column 2"},
+		{"_1", "Could not find a token starting at: _1 at line 1, column 1"},
+		{"1_", "Could not find a token starting at: _ at line 1, column 2"},
+	}
+	for _, tt := range tests {
+		_, err := Tokenize(tt.text)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: got error %v, want %s", tt.text, err, tt.want)
+		}
+	}
+}
+
+// The value of a numeric literal token
+func numberValue(t Token) (string, error) {
+	var v datatype.DataType
+	var err error
+	switch t := t.(type) {
+	case Integer:
+		v, err = t.Integer()
+	case Double:
+		v, err = t.Double()
+	case Decimal:
+		v, err = t.Decimal()
+	default:
+		return "", fmt.Errorf("Not a number: %s", t.TokenText())
+	}
+	if err != nil {
+		return "", err
+	}
+	return datatype.ToPrint(v), nil
+}
+
+func TestNumberValues(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"1_000_000", "1000000"},
+		{"0x1F", "31"},
+		{"0X1f", "31"},
+		{"0o17", "15"},
+		{"0b1010", "10"},
+		{"0xFF_FF", "65535"},
+		{"9223372036854775807", "9223372036854775807"},
+		{"-9223372036854775808", "-9223372036854775808"},
+		{".5", "0.5"},
+		{"5.", "5"},
+		{"1e6", "1e+06"},
+		{"1E-3", "0.001"},
+		{"1.5e3", "1500"},
+		{"10.50M", "10.50"},
+		{"1_000.5M", "1000.5"},
+
+		{"0x", "error: Invalid Int value: 0x at line 1, column 1"},
+		{"9223372036854775808", "error: Int value 9223372036854775808 is out of range at line 1, column 1"},
+		{"-9223372036854775809", "error: Int value -9223372036854775809 is out of range at line 1, column 1"},
+		{"0xFFFFFFFFFFFFFFFFF", "error: Int value 0xFFFFFFFFFFFFFFFFF is out of range at line 1, column 1"},
+		{"1e400", "error: Double value 1e400 is out of range at line 1, column 1"},
+	}
+	for _, tt := range tests {
+		tokens, err := Tokenize(tt.text)
+		if err != nil || len(tokens) != 1 {
+			t.Errorf("%q: got tokens %v, error %v, want a single number", tt.text, tokens, err)
+			continue
+		}
+		got, err := numberValue(tokens[0])
+		if err != nil {
+			if _, ok := err.(*SyntaxError); !ok {
+				t.Errorf("%q: got %T, want a *SyntaxError", tt.text, err)
+			}
+			got = "error: " + err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
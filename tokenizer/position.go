@@ -0,0 +1,69 @@
+package tokenizer
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// A position in the text of an expression
+type Position struct {
+	Offset int // Byte offset, starting at 0
+	Line   int // Line number, starting at 1
+	Column int // Column in characters (not bytes), starting at 1
+}
+
+// The position of the start of an expression
+var startPosition = Position{Offset: 0, Line: 1, Column: 1}
+
+func (p Position) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+// The position after text that starts at p
+func (p Position) advance(text string) Position {
+	for len(text) > 0 {
+		r, size := utf8.DecodeRuneInString(text)
+		text = text[size:]
+
+		p.Offset += size
+		if r == '\n' {
+			p.Line++
+			p.Column = 1
+		} else {
+			p.Column++
+		}
+	}
+	return p
+}
+
+// A part of the text of an expression. End is the position just after the
+// last character.
+type Span struct {
+	Start, End Position
+}
+
+func (s Span) String() string {
+	return s.Start.String()
+}
+
+// Error code of a SyntaxError
+const ErrorCodeSyntax = "syntax_error"
+
+// A syntax error found while tokenizing or parsing an expression
+type SyntaxError struct {
+	Span Span
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at %s", e.Msg, e.Span)
+}
+
+func (e *SyntaxError) Code() string { return ErrorCodeSyntax }
+
+func (e *SyntaxError) ErrorSpan() Span { return e.Span }
+
+// Create a syntax error for a span of the expression
+func SyntaxErrorf(span Span, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Span: span, Msg: fmt.Sprintf(format, args...)}
+}
@@ -3,26 +3,34 @@ package tokenizer
 // Precedence of operators: higher number means higher precedence
 
 var arithmeticOperatorPrecedence = map[string]int{
-	"+": 7,
-	"-": 7,
+	"+": 8,
+	"-": 8,
 	"*": 10,
 	"/": 10,
-	"#": 20,
+	"#": 10,
+	"^": 10,
 }
 
 var relationalOperatorPrecedence = map[string]int{
-	"=":  5,
-	"<>": 5,
-	">":  5,
-	"<":  5,
+	"=":  7,
+	"<>": 7,
+	">":  7,
+	"<":  7,
+	">=": 7,
+	"<=": 7,
 }
 
 var logicalOperatorPrecedence = map[string]int{
-	"&&": 30,
-	"||": 25,
+	"&&": 6,
+	"&":  6,
+	"||": 5,
+	"|":  5,
 	"!":  40,
 }
 
+// Lower than all other binary operators, so a || b ?? c is (a || b) ?? c
+const PrecedenceCoalesce = 4
+
 const (
 	PrecedenceBracket  = 1
 	PrecedenceColon    = 2
@@ -0,0 +1,602 @@
+package tokenizer
+
+import (
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Scanner splits the text of an expression into tokens in a single pass.
+// Tokens are recognised by their first character, so only the text of the
+// token being scanned is looked at. The text can be read incrementally from
+// an io.Reader, which allows scanning large files of expressions.
+type Scanner struct {
+	r     io.Reader
+	chunk []byte // Buffer for reading from r
+	eof   bool   // Set when all of the text is in src
+
+	src  string   // Text that has been read but not scanned yet, from off
+	off  int      // Byte offset of the next token in src
+	pos  Position // Position of the next token
+	prev Token    // The last token that isn't white space or a comment
+}
+
+// How far past the end of a token the scanner may have to look to be sure
+// the token is complete, eg. to tell <DateTime> from <.
+const maxLookahead = 16
+
+// NewScanner creates a scanner that reads the text from r
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{r: r, pos: startPosition}
+}
+
+func newScanner(src string) *Scanner {
+	return &Scanner{src: src, eof: true, pos: startPosition}
+}
+
+// Next returns the next token, or io.EOF at the end of the text. After a
+// syntax error the offending character is skipped, so Next can be called
+// again to continue scanning. Errors from the reader are returned as is.
+func (s *Scanner) Next() (Token, error) {
+	var rem string
+	var n int
+	var tokenType TokenType
+
+	for {
+		rem = s.src[s.off:]
+		if rem != "" {
+			n, tokenType = s.match(rem)
+			if s.complete(rem, n, tokenType) {
+				break
+			}
+		} else if s.eof {
+			return nil, io.EOF
+		}
+
+		if err := s.fill(); err != nil {
+			return nil, err
+		}
+	}
+
+	if n == 0 {
+		_, size := utf8.DecodeRuneInString(rem)
+		span := Span{s.pos, s.pos.advance(rem[:size])}
+		s.off += size
+		s.pos = span.End
+		if isQuote(rem[0]) {
+			return nil, SyntaxErrorf(span, "Missing closing quote for: %s", firstLine(rem))
+		}
+		if strings.HasPrefix(rem, "/*") {
+			return nil, SyntaxErrorf(span, "Missing */ for comment: %s", firstLine(rem))
+		}
+		return nil, SyntaxErrorf(span, "Could not find a token starting at: %s", firstLine(rem))
+	}
+
+	text := rem[:n]
+	t := newToken(baseToken{tokenType: tokenType, text: text, span: Span{s.pos, s.pos.advance(text)}})
+
+	s.off += n
+	s.pos = t.Span().End
+	if _, ok := t.(Trivia); !ok {
+		s.prev = t
+	}
+
+	return t, nil
+}
+
+// Check if the token matched at the start of rem is complete, ie. reading more
+// text can't change it
+func (s *Scanner) complete(rem string, n int, tokenType TokenType) bool {
+	switch {
+	case s.eof:
+		return true
+	case n == 0 && (isQuote(rem[0]) || strings.HasPrefix(rem, "/*")):
+		// A string, char or comment that isn't terminated yet
+		return false
+	case len(rem)-n <= maxLookahead:
+		return false
+	case tokenType == TokenTypeSymbol:
+		// A '(' after any amount of white space makes it a method
+		return !isFollowedBySpaceOnly(rem[n:])
+	}
+	return true
+}
+
+// Read more text from the reader. The text that has been scanned is dropped.
+func (s *Scanner) fill() error {
+	if s.chunk == nil {
+		s.chunk = make([]byte, 4096)
+	}
+
+	n, err := s.r.Read(s.chunk)
+	s.src = s.src[s.off:] + string(s.chunk[:n])
+	s.off = 0
+
+	if err == io.EOF {
+		s.eof = true
+		return nil
+	}
+	return err
+}
+
+// Find the token at the start of rem. Returns the length of the token text
+// and its type, or 0 if rem doesn't start with a token.
+func (s *Scanner) match(rem string) (int, TokenType) {
+	switch c := rem[0]; {
+	case c == '<':
+		if n := matchTypeCast(rem); n > 0 {
+			return n, TokenTypeTypeCast
+		}
+		if strings.HasPrefix(rem, RelationalOperatorNotEqualTo) || strings.HasPrefix(rem, RelationalOperatorLesserOrEqualTo) {
+			return 2, TokenTypeRelationalOperator
+		}
+		return 1, TokenTypeRelationalOperator
+	case c == '>':
+		if strings.HasPrefix(rem, RelationalOperatorGreaterOrEqualTo) {
+			return 2, TokenTypeRelationalOperator
+		}
+		return 1, TokenTypeRelationalOperator
+	case c == '=':
+		return 1, TokenTypeRelationalOperator
+
+	case c == '!':
+		return 1, TokenTypeLogicalOperator
+	case c == '&' || c == '|':
+		if len(rem) > 1 && rem[1] == c {
+			return 2, TokenTypeLogicalOperator
+		}
+		return 1, TokenTypeLogicalOperator
+
+	case c == '-':
+		// The special unary '-'. If a '-' is at the start of the expression
+		// OR follows an operator OR follows an open bracket, then consider it
+		// and the following number as a single numerical token.
+		if s.atOperandStart() {
+			if n, tokenType := matchNumber(rem[1:]); n > 0 {
+				return n + 1, tokenType
+			}
+		}
+		return 1, TokenTypeArithmeticOperator
+	case c == '/' && len(rem) > 1 && (rem[1] == '/' || rem[1] == '*'):
+		return matchComment(rem), TokenTypeComment
+	case strings.IndexByte("+*/#^", c) >= 0:
+		return 1, TokenTypeArithmeticOperator
+
+	case c == '(' || c == '[' || c == '{':
+		return 1, TokenTypeOpenBracket
+	case c == '@' && strings.HasPrefix(rem, BracketMap):
+		return 2, TokenTypeOpenBracket
+	case c == ')' || c == ']' || c == '}':
+		return 1, TokenTypeCloseBracket
+
+	case letterLen(rem) > 0:
+		if n := matchISODuration(rem); n > 0 {
+			return n, TokenTypeDuration
+		}
+		if n := matchKeyword(rem, "true", "false"); n > 0 {
+			return n, TokenTypeBool
+		}
+		if n := matchKeyword(rem, "null"); n > 0 {
+			return n, TokenTypeNull
+		}
+		n := matchIdentifier(rem)
+		// An identifier followed by a '(' is the name of an intrinsic method.
+		// Any other identifier refers to a symbol.
+		if isFollowedByOpenParan(rem[n:]) {
+			return n, TokenTypeIntrinsicMethod
+		}
+		return n, TokenTypeSymbol
+
+	case isSpace(c):
+		n := 1
+		for n < len(rem) && isSpace(rem[n]) {
+			n++
+		}
+		return n, TokenTypeWhitespace
+
+	case c == ',':
+		return 1, TokenTypeComma
+	case c == ':':
+		return 1, TokenTypeColon
+	case c == '?':
+		if strings.HasPrefix(rem, NullCoalescingOperator) {
+			return 2, TokenTypeCoalesceOperator
+		}
+		return 1, TokenTypeQuestion
+	case c == '.':
+		if n, tokenType := matchNumber(rem); n > 0 {
+			return n, tokenType
+		}
+		return 1, TokenTypeDot
+
+	case isDigit(c):
+		return matchNumber(rem)
+	case c == '"' || c == '`':
+		return matchQuoted(rem), TokenTypeString
+	case c == '\'':
+		return matchQuoted(rem), TokenTypeChar
+	}
+
+	return 0, ""
+}
+
+// Check if the next token starts an operand, ie. it follows an operator, an
+// open bracket, a separator or nothing
+func (s *Scanner) atOperandStart() bool {
+	switch s.prev.(type) {
+	case nil, Operator, OpenBracket, Comma, Colon:
+		return true
+	}
+	return false
+}
+
+// Build the concrete token for a matched text
+func newToken(bt baseToken) Token {
+	switch bt.tokenType {
+	case TokenTypeTypeCast:
+		return typeCastToken{bt}
+	case TokenTypeLogicalOperator:
+		return logicalOperatorToken{bt}
+	case TokenTypeArithmeticOperator:
+		return arithmeticOperatorToken{bt}
+	case TokenTypeRelationalOperator:
+		return relationalOperatorToken{bt}
+	case TokenTypeCoalesceOperator:
+		return coalesceOperatorToken{bt}
+	case TokenTypeOpenBracket:
+		return openBracketToken{bt}
+	case TokenTypeCloseBracket:
+		return closeBracketToken{bt}
+	case TokenTypeBool:
+		return boolToken{bt}
+	case TokenTypeNull:
+		return nullToken{bt}
+	case TokenTypeIntrinsicMethod:
+		return intrinsicMethodToken{bt}
+	case TokenTypeSymbol:
+		return symbolToken{bt}
+	case TokenTypeWhitespace:
+		return whitespaceToken{bt}
+	case TokenTypeComment:
+		return commentToken{bt}
+	case TokenTypeComma:
+		return commaToken{bt}
+	case TokenTypeColon:
+		return colonToken{bt}
+	case TokenTypeQuestion:
+		return questionToken{bt}
+	case TokenTypeDot:
+		return dotToken{bt}
+	case TokenTypeDouble:
+		return doubleToken{bt}
+	case TokenTypeDecimal:
+		return decimalToken{bt}
+	case TokenTypeDuration:
+		return durationToken{bt}
+	case TokenTypeInteger:
+		return integerToken{bt}
+	case TokenTypeString:
+		return stringToken{bt}
+	default:
+		return charToken{bt}
+	}
+}
+
+// Data types that can be used in a type cast, eg. <Int>
+var typeCastNames = map[string]bool{
+	"b": true, "bool": true,
+	"s": true, "string": true,
+	"d": true, "double": true,
+	"i": true, "int": true, "int32": true,
+	"m": true, "decimal": true,
+	"c": true, "char": true,
+	"h": true, "datetime": true,
+	"duration": true, "timespan": true,
+}
+
+func matchTypeCast(rem string) int {
+	n := 1
+	for n < len(rem) && isAlphanumeric(rem[n]) {
+		n++
+	}
+	if n == len(rem) || rem[n] != '>' || !typeCastNames[strings.ToLower(rem[1:n])] {
+		return 0
+	}
+	return n + 1
+}
+
+// One of the keywords, in any case, that isn't the start of a longer word
+func matchKeyword(rem string, keywords ...string) int {
+	n := 0
+	for n < len(rem) && (isAlphanumeric(rem[n]) || rem[n] == '_') {
+		n++
+	}
+	if isFollowedByWordChar(rem[n:]) {
+		return 0
+	}
+	w := strings.ToLower(rem[:n])
+	for _, k := range keywords {
+		if w == k {
+			return n
+		}
+	}
+	return 0
+}
+
+// A name, with optional dotted parts like Math.PI. Names start with a letter
+// and can have letters from any script, eg. Straße.
+func matchIdentifier(rem string) int {
+	n := 0
+	for {
+		n += letterLen(rem[n:])
+		for m := alphanumericLen(rem[n:]); m > 0; m = alphanumericLen(rem[n:]) {
+			n += m
+		}
+		if n+1 >= len(rem) || rem[n] != '.' || letterLen(rem[n+1:]) == 0 {
+			return n
+		}
+		n++
+	}
+}
+
+// A numeric literal. Integers can be decimal, hex (0x1F), octal (0o17) or
+// binary (0b1010). Doubles have a fraction, an exponent or both, eg. 1.5, .5,
+// 5. or 1e6. Digits can be separated by underscores, eg. 1_000_000. A number
+// with an M suffix is a Decimal, eg. 10.50M. Numbers with units are a
+// Duration, eg. 2h30m.
+func matchNumber(rem string) (int, TokenType) {
+	if n := matchDuration(rem); n > 0 {
+		return n, TokenTypeDuration
+	}
+	if len(rem) > 1 && rem[0] == '0' {
+		switch rem[1] {
+		case 'x', 'X':
+			return 2 + digits(rem[2:], isHexDigit), TokenTypeInteger
+		case 'o', 'O':
+			return 2 + digits(rem[2:], isOctalDigit), TokenTypeInteger
+		case 'b', 'B':
+			return 2 + digits(rem[2:], isBinaryDigit), TokenTypeInteger
+		}
+	}
+
+	var tokenType TokenType = TokenTypeInteger
+
+	n := digits(rem, isDigit)
+	if n < len(rem) && rem[n] == '.' {
+		// A '.' followed by a name is member access, not a fraction
+		if f := digits(rem[n+1:], isDigit); f > 0 || (n > 0 && !(n+1 < len(rem) && isLetter(rem[n+1]))) {
+			n += 1 + f
+			tokenType = TokenTypeDouble
+		}
+	}
+	if n == 0 {
+		return 0, ""
+	}
+
+	if e := matchExponent(rem[n:]); e > 0 {
+		n += e
+		tokenType = TokenTypeDouble
+	}
+	if n < len(rem) && rem[n] == 'M' && !(n+1 < len(rem) && isAlphanumeric(rem[n+1])) {
+		return n + 1, TokenTypeDecimal
+	}
+	return n, tokenType
+}
+
+var durationUnits = map[string]bool{"d": true, "h": true, "m": true, "s": true, "ms": true}
+
+// Numbers followed by units, eg. 2h30m, 1.5d or 500ms
+func matchDuration(rem string) int {
+	n := 0
+	for {
+		d := digits(rem[n:], isDigit)
+		if d == 0 {
+			break
+		}
+		m := n + d
+		if m < len(rem) && rem[m] == '.' {
+			m += 1 + digits(rem[m+1:], isDigit)
+		}
+		u := m
+		for u < len(rem) && rem[u] >= 'a' && rem[u] <= 'z' {
+			u++
+		}
+		if !durationUnits[rem[m:u]] {
+			break
+		}
+		n = u
+	}
+	if n == 0 || isFollowedByWordChar(rem[n:]) {
+		return 0
+	}
+	return n
+}
+
+// An ISO 8601 duration, eg. P1DT2H30M. Years and months are matched here but
+// rejected when the value is parsed.
+func matchISODuration(rem string) int {
+	if rem[0] != 'P' {
+		return 0
+	}
+
+	n, parts, inTime := 1, 0, false
+	for n < len(rem) {
+		if rem[n] == 'T' && !inTime {
+			inTime = true
+			n++
+			continue
+		}
+		d := digits(rem[n:], isDigit)
+		if d == 0 {
+			break
+		}
+		m := n + d
+		if m < len(rem) && (rem[m] == '.' || rem[m] == ',') {
+			m += 1 + digits(rem[m+1:], isDigit)
+		}
+		designators := "YMWD"
+		if inTime {
+			designators = "HMS"
+		}
+		if m == len(rem) || strings.IndexByte(designators, rem[m]) < 0 {
+			return 0
+		}
+		n = m + 1
+		parts++
+	}
+	if parts == 0 || rem[n-1] == 'T' || isFollowedByWordChar(rem[n:]) {
+		return 0
+	}
+	return n
+}
+
+// An exponent, eg. e6 or E-3
+func matchExponent(rem string) int {
+	if len(rem) == 0 || (rem[0] != 'e' && rem[0] != 'E') {
+		return 0
+	}
+	n := 1
+	if n < len(rem) && (rem[n] == '+' || rem[n] == '-') {
+		n++
+	}
+	if d := digits(rem[n:], isDigit); d > 0 {
+		return n + d
+	}
+	return 0
+}
+
+// Digits, optionally separated by single underscores
+func digits(rem string, valid func(byte) bool) int {
+	n := 0
+	for n < len(rem) && valid(rem[n]) {
+		n++
+		if n+1 < len(rem) && rem[n] == '_' && valid(rem[n+1]) {
+			n++
+		}
+	}
+	return n
+}
+
+// A quoted string or char. A backslash escapes the character after it,
+// except in a raw string quoted with backticks.
+func matchQuoted(rem string) int {
+	quote := rem[0]
+	for n := 1; n < len(rem); n++ {
+		switch rem[n] {
+		case quote:
+			return n + 1
+		case '\\':
+			if quote != '`' {
+				n++
+			}
+		}
+	}
+	return 0
+}
+
+// A // comment up to the end of the line, or a /* */ comment
+func matchComment(rem string) int {
+	if rem[1] == '/' {
+		if i := strings.IndexByte(rem, '\n'); i >= 0 {
+			return i
+		}
+		return len(rem)
+	}
+	if i := strings.Index(rem[2:], "*/"); i >= 0 {
+		return i + 4
+	}
+	return 0
+}
+
+// Check if s starts with a character that could continue a name
+func isFollowedByWordChar(s string) bool {
+	return alphanumericLen(s) > 0 || strings.HasPrefix(s, "_")
+}
+
+func isQuote(c byte) bool {
+	return c == '"' || c == '\'' || c == '`'
+}
+
+// Check if the next token in s, ignoring white space, is a '('
+func isFollowedByOpenParan(s string) bool {
+	for len(s) > 0 && isSpace(s[0]) {
+		s = s[1:]
+	}
+	return strings.HasPrefix(s, BracketParans)
+}
+
+func isFollowedBySpaceOnly(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isSpace(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// The text up to the end of the line, for use in error messages
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// The length in bytes of the letter at the start of s, or 0 if s doesn't
+// start with a letter
+func letterLen(s string) int {
+	if s == "" {
+		return 0
+	}
+	if s[0] < utf8.RuneSelf {
+		if isLetter(s[0]) {
+			return 1
+		}
+		return 0
+	}
+	if r, size := utf8.DecodeRuneInString(s); unicode.IsLetter(r) {
+		return size
+	}
+	return 0
+}
+
+// The length in bytes of the letter or digit at the start of s, or 0
+func alphanumericLen(s string) int {
+	if s != "" && isDigit(s[0]) {
+		return 1
+	}
+	return letterLen(s)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func isOctalDigit(c byte) bool {
+	return '0' <= c && c <= '7'
+}
+
+func isBinaryDigit(c byte) bool {
+	return c == '0' || c == '1'
+}
+
+func isAlphanumeric(c byte) bool {
+	return isLetter(c) || isDigit(c)
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\f', '\r':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var scannerCorpus = []string{
+	`Max(1, 2.5) + Amount * 1_000 - 0x1F`,
+	`"a string with \"escaped\" quotes and a \\ backslash" + 'c' + '\''`,
+	"`raw \\ string` + \"tab\\t\"",
+	`Order.Customer.Name == "Miss." && Order.Total >= 10.50M`,
+	"1 /* a block\ncomment */ + 2 // a line comment\n+ 3",
+	"1 // comment at the end",
+	`<DateTime>"2024-12-27" + 2h30m + P1DT2H`,
+	`<D>"100.5" <= 1e-3 || a <> b`,
+	"Trim  \t (Name)",
+	`[1, 2]{0} ?? Default`,
+	`"unterminated`,
+	`1 /* unterminated`,
+	`1 $ 2`,
+	"",
+}
+
+// Scan all of the text, including the tokens after a syntax error
+func scanAll(sc *Scanner) string {
+	var out []string
+	for {
+		t, err := sc.Next()
+		if err == io.EOF {
+			return strings.Join(out, " ")
+		}
+		if err != nil {
+			out = append(out, "error: "+err.Error())
+			continue
+		}
+		out = append(out, fmt.Sprintf("%s %q %v-%v", t.TokenType(), t.TokenText(), t.Span().Start, t.Span().End))
+	}
+}
+
+func TestScannerOneByteAtATime(t *testing.T) {
+	for _, text := range scannerCorpus {
+		want := scanAll(newScanner(text))
+		got := scanAll(NewScanner(iotest.OneByteReader(strings.NewReader(text))))
+		if got != want {
+			t.Errorf("%q:\n got  %s\n want %s", text, got, want)
+		}
+	}
+}
+
+func TestScannerRefillBoundary(t *testing.T) {
+	// Put each token of the corpus across the end of the first 4096 byte chunk
+	for _, text := range scannerCorpus {
+		for pad := 4096 - len(text); pad <= 4096; pad++ {
+			if pad < 0 {
+				continue
+			}
+			padded := strings.Repeat(" ", pad) + text
+			want := scanAll(newScanner(padded))
+			got := scanAll(NewScanner(strings.NewReader(padded)))
+			if got != want {
+				t.Errorf("%q with %d spaces before it:\n got  %s\n want %s", text, pad, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestScannerUnterminated(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`"abc\"`, `Missing closing quote for: "abc\"`},
+		{"/* abc\n*", "Missing */ for comment: /* abc"},
+	}
+	for _, tt := range tests {
+		sc := NewScanner(iotest.OneByteReader(strings.NewReader(tt.text)))
+		_, err := sc.Next()
+		var se *SyntaxError
+		if !errors.As(err, &se) || se.Msg != tt.want {
+			t.Errorf("%q: got error %v, want %q", tt.text, err, tt.want)
+			continue
+		}
+		if se.Span.Start != startPosition {
+			t.Errorf("%q: error at %v, want %v", tt.text, se.Span.Start, startPosition)
+		}
+	}
+}
+
+func TestScannerReaderError(t *testing.T) {
+	errRead := errors.New("read failed")
+	// The tokens are only returned once the scanner can look past them
+	r := io.MultiReader(strings.NewReader("1 + 2"+strings.Repeat(" ", maxLookahead+1)), iotest.ErrReader(errRead))
+	sc := NewScanner(iotest.OneByteReader(r))
+
+	var texts []string
+	for {
+		tok, err := sc.Next()
+		if err != nil {
+			if err != errRead {
+				t.Fatalf("got error %v, want %v", err, errRead)
+			}
+			break
+		}
+		texts = append(texts, tok.TokenText())
+	}
+	if got, want := strings.Join(texts, "|"), "1| |+| |2"; got != want {
+		t.Errorf("got tokens %q before the error, want %q", got, want)
+	}
+}
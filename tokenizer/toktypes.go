@@ -8,19 +8,25 @@ const (
 	TokenTypeSymbol = "symbol"
 
 	TokenTypeWhitespace = "whitespace"
+	TokenTypeComment    = "comment"
 	TokenTypeComma      = "comma"
 	TokenTypeColon      = "colon"
 	TokenTypeQuestion   = "?"
+	TokenTypeDot        = "dot"
 
-	TokenTypeDouble  = "double"
-	TokenTypeInteger = "integer"
-	TokenTypeString  = "string"
-	TokenTypeChar    = "char"
-	TokenTypeBool    = "bool"
+	TokenTypeDouble   = "double"
+	TokenTypeDecimal  = "decimal"
+	TokenTypeDuration = "duration"
+	TokenTypeInteger  = "integer"
+	TokenTypeString   = "string"
+	TokenTypeChar     = "char"
+	TokenTypeBool     = "bool"
+	TokenTypeNull     = "null"
 
 	TokenTypeLogicalOperator    = "logical_op"
 	TokenTypeArithmeticOperator = "arithmetic_op"
 	TokenTypeRelationalOperator = "relational_op"
+	TokenTypeCoalesceOperator   = "coalesce_op"
 
 	TokenTypeTypeCast = "type_cast"
 
@@ -43,7 +49,10 @@ const (
 	RelationalOperatorGreaterOrEqualTo = ">="
 	RelationalOperatorLesserOrEqualTo  = "<="
 
+	NullCoalescingOperator = "??"
+
 	BracketParans = "("
 	BracketSquare = "["
 	BracketCurly  = "{"
+	BracketMap    = "@{" // Closed by }
 )